@@ -0,0 +1,119 @@
+package envtesthelper
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+)
+
+// appliedFixture is a fixture created through server-side apply instead of a plain create.
+type appliedFixture struct {
+	client.Object
+	fieldManager string
+	force        bool
+}
+
+// DeepCopyObject keeps copies of the fixture applied, e.g. for State shared by a Group.
+func (a *appliedFixture) DeepCopyObject() runtime.Object {
+	c := *a
+	c.Object = a.Object.DeepCopyObject().(client.Object)
+	return &c
+}
+
+// ApplyAs makes obj a fixture created through server-side apply by fieldManager,
+// e.g. to simulate fields set by kubectl, users or other controllers.
+func ApplyAs(obj client.Object, fieldManager string) client.Object {
+	return &appliedFixture{Object: obj, fieldManager: fieldManager}
+}
+
+// ForceApplyAs is like ApplyAs, but takes ownership of fields managed by others, like a previous fixture.
+func ForceApplyAs(obj client.Object, fieldManager string) client.Object {
+	return &appliedFixture{Object: obj, fieldManager: fieldManager, force: true}
+}
+
+// fixtureObj returns the object of a fixture, unwrapping applied ones.
+func fixtureObj(obj client.Object) client.Object {
+	if a, ok := obj.(*appliedFixture); ok {
+		return a.Object
+	}
+	return obj
+}
+
+// apply creates or updates obj through server-side apply.
+func (f *fixtureSet) apply(ctx context.Context, obj client.Object, a *appliedFixture) error {
+	gvk, err := f.c.GroupVersionKindFor(obj)
+	if err != nil {
+		return err
+	}
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+	opts := []client.PatchOption{client.FieldOwner(a.fieldManager)}
+	if a.force {
+		opts = append(opts, client.ForceOwnership)
+	}
+	return f.c.Patch(ctx, obj, client.Apply, opts...)
+}
+
+// fieldOwners maps the fields of obj, like ".data.foo", to the managers owning them.
+func fieldOwners(obj client.Object) (map[string][]string, error) {
+	owners := map[string][]string{}
+	for _, entry := range obj.GetManagedFields() {
+		if entry.FieldsV1 == nil {
+			continue
+		}
+		fields := &fieldpath.Set{}
+		if err := fields.FromJSON(bytes.NewReader(entry.FieldsV1.Raw)); err != nil {
+			return nil, fmt.Errorf("parse fields of %s: %w", entry.Manager, err)
+		}
+		fields.Iterate(func(p fieldpath.Path) {
+			field := p.String()
+			if !slices.Contains(owners[field], entry.Manager) {
+				owners[field] = append(owners[field], entry.Manager)
+			}
+		})
+	}
+	return owners, nil
+}
+
+// WantFieldOwner asserts fieldManager owns the given fields of obj, e.g.
+// e.WantFieldOwner(ctx, cm, "my-controller", ".data.foo", ".metadata.labels.app").
+// Fields may be shared with other managers. obj is read from the apiserver directly.
+func (e *Env) WantFieldOwner(ctx context.Context, obj client.Object, fieldManager string, fields ...string) {
+	e.T.Helper()
+	e.wantFieldOwner(ctx, obj, fieldManager, fields, true)
+}
+
+// WantNotFieldOwner asserts fieldManager owns none of the given fields of obj,
+// e.g. after another manager forced the ownership of them.
+func (e *Env) WantNotFieldOwner(ctx context.Context, obj client.Object, fieldManager string, fields ...string) {
+	e.T.Helper()
+	e.wantFieldOwner(ctx, obj, fieldManager, fields, false)
+}
+
+func (e *Env) wantFieldOwner(ctx context.Context, obj client.Object, fieldManager string, fields []string, want bool) {
+	e.T.Helper()
+	current := fixtureObj(obj).DeepCopyObject().(client.Object)
+	key := client.ObjectKeyFromObject(current)
+	if err := e.harness.Get(ctx, key, current); err != nil {
+		e.T.Errorf("get obj: %s", err)
+		return
+	}
+	owners, err := fieldOwners(current)
+	if err != nil {
+		e.T.Errorf("%s: %s", key, err)
+		return
+	}
+	for _, field := range fields {
+		if got := slices.Contains(owners[field], fieldManager); got != want {
+			not := ""
+			if !want {
+				not = "not "
+			}
+			e.T.Errorf("%s: got %s owned by %v, want %s%s", key, field, owners[field], not, fieldManager)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package envtesthelper
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+func Test_RunEnvTest_apply(t *testing.T) {
+	tests := []TestCase[*applyReconciler]{
+		{
+			Name: "forced conflict",
+			Obj: ApplyAs(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-cm"},
+				Data:       map[string]string{"foo": "kubectl", "other": "kubectl"},
+			}, "kubectl"),
+			WantSideEffects: func(ctx context.Context, e *Env, r *applyReconciler) {
+				cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "test-cm", Namespace: e.RunNamespace}}
+				e.WantFieldOwner(ctx, cm, "test-controller", ".data.foo")
+				e.WantNotFieldOwner(ctx, cm, "kubectl", ".data.foo")
+				e.WantFieldOwner(ctx, cm, "kubectl", ".data.other")
+			},
+		},
+	}
+	RunEnvTest(
+		t,
+		corev1.AddToScheme,
+		&envtest.Environment{},
+		func(e *Env) *applyReconciler {
+			return &applyReconciler{Client: e.Client}
+		},
+		tests,
+	)
+}
+
+// applyReconciler sets .data.foo through server-side apply, taking it over from other managers.
+type applyReconciler struct {
+	Client client.Client
+}
+
+func (r *applyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	cm := &corev1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{Name: req.Name, Namespace: req.Namespace},
+		Data:       map[string]string{"foo": "bar"},
+	}
+	if err := r.Client.Patch(ctx, cm, client.Apply, client.FieldOwner("test-controller"), client.ForceOwnership); err != nil {
+		return ctrl.Result{}, fmt.Errorf("apply obj: %w", err)
+	}
+	return ctrl.Result{}, nil
+}
+
+func Test_fieldOwners(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			ManagedFields: []metav1.ManagedFieldsEntry{
+				{
+					Manager:   "kubectl",
+					Operation: metav1.ManagedFieldsOperationApply,
+					FieldsV1:  &metav1.FieldsV1{Raw: []byte(`{"f:data":{"f:foo":{},"f:other":{}}}`)},
+				},
+				{
+					Manager:   "test-controller",
+					Operation: metav1.ManagedFieldsOperationApply,
+					FieldsV1:  &metav1.FieldsV1{Raw: []byte(`{"f:data":{"f:foo":{}},"f:metadata":{"f:labels":{".":{},"f:app":{}}}}`)},
+				},
+			},
+		},
+	}
+	got, err := fieldOwners(cm)
+	if err != nil {
+		t.Fatalf("field owners: %s", err)
+	}
+	want := map[string][]string{
+		".data.foo":            {"kubectl", "test-controller"},
+		".data.other":          {"kubectl"},
+		".metadata.labels":     {"test-controller"},
+		".metadata.labels.app": {"test-controller"},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("got: %v\nwant: %v\ndiff: %s", got, want, diff)
+	}
+}
+
+func Test_appliedFixture_DeepCopyObject(t *testing.T) {
+	obj := ForceApplyAs(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm"}}, "kubectl")
+	copies := copyFixtures([]client.Object{obj})
+	got, ok := copies[0].(*appliedFixture)
+	if !ok {
+		t.Fatalf("got %T, want applied fixture", copies[0])
+	}
+	if got.fieldManager != "kubectl" || !got.force {
+		t.Errorf("got manager %q force %v, want %q force true", got.fieldManager, got.force, "kubectl")
+	}
+	got.SetName("other")
+	if obj.GetName() != "cm" {
+		t.Errorf("copy shares obj with the original")
+	}
+}
+
+func Test_Env_WantFieldOwner_harness(t *testing.T) {
+	ctx := context.Background()
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cm",
+			Namespace: "default",
+			ManagedFields: []metav1.ManagedFieldsEntry{{
+				Manager:   "test-controller",
+				Operation: metav1.ManagedFieldsOperationApply,
+				FieldsV1:  &metav1.FieldsV1{Raw: []byte(`{"f:data":{"f:foo":{}}}`)},
+			}},
+		},
+	}
+	harness := fake.NewClientBuilder().WithObjects(cm.DeepCopy()).Build()
+	// a stale cache of the reconciler, which did not see the obj yet
+	stale := fake.NewClientBuilder().Build()
+	tb := &errorCapturingTB{TB: t}
+	e := &Env{T: tb, Client: stale, harness: harness}
+
+	e.WantFieldOwner(ctx, cm, "test-controller", ".data.foo")
+	e.WantNotFieldOwner(ctx, cm, "kubectl", ".data.foo")
+	if len(tb.errors) > 0 {
+		t.Errorf("got errors %v, want obj read from the apiserver", tb.errors)
+	}
+}
@@ -0,0 +1,80 @@
+package envtesthelper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// artifactsDir returns the directory to write artifacts of failed testcases to, empty if not set.
+// Set by -envtest.artifacts-dir, defaults to $ARTIFACTS as used by prow.
+func artifactsDir() string {
+	if artifactsDirFlag != "" {
+		return artifactsDirFlag
+	}
+	return os.Getenv("ARTIFACTS")
+}
+
+// tempArtifactsDirs are the temporary artifacts directories of testcases, by test name.
+var tempArtifactsDirs sync.Map
+
+// caseArtifactsDir returns the artifacts directory of the testcase running in t, one level per subtest.
+// Without an artifacts directory set, a temporary directory is created per testcase on first use.
+// As artifacts are only written for failed testcases, passing ones leave nothing behind.
+func caseArtifactsDir(t testing.TB) (string, error) {
+	if dir := artifactsDir(); dir != "" {
+		return filepath.Join(dir, caseDir(t.Name())), nil
+	}
+	if dir, ok := tempArtifactsDirs.Load(t.Name()); ok {
+		return dir.(string), nil
+	}
+	dir, err := os.MkdirTemp("", "envtest-artifacts-"+filepath.Base(caseDir(t.Name()))+"-")
+	if err != nil {
+		return "", fmt.Errorf("artifacts dir: %w", err)
+	}
+	if existing, loaded := tempArtifactsDirs.LoadOrStore(t.Name(), dir); loaded {
+		_ = os.Remove(dir)
+		return existing.(string), nil
+	}
+	return dir, nil
+}
+
+// writeArtifact writes data to name within the artifacts directory of the testcase running in t, returning its path.
+func writeArtifact(t testing.TB, name string, data []byte) (string, error) {
+	dir, err := caseArtifactsDir(t)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("write artifact %s: %w", name, err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", fmt.Errorf("write artifact %s: %w", name, err)
+	}
+	return path, nil
+}
+
+// caseDir turns the name of a (sub)test into a relative directory, one level per subtest.
+// Segments which would leave the directory, like "..", are replaced.
+func caseDir(name string) string {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segment = strings.Map(func(r rune) rune {
+			switch {
+			case r == '-' || r == '_' || r == '.' ||
+				'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9':
+				return r
+			}
+			return '_'
+		}, segment)
+		if strings.Trim(segment, ".") == "" {
+			segment = strings.Repeat("_", max(len(segment), 1))
+		}
+		segments[i] = segment
+	}
+	return filepath.Join(segments...)
+}
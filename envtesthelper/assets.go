@@ -0,0 +1,227 @@
+package envtesthelper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// assetBinaries are the binaries envtest needs to run a control plane, kubectl is optional.
+var assetBinaries = []string{"etcd", "kube-apiserver"}
+
+// defaultAssetsDir is where envtest looks for binaries if nothing else is configured.
+const defaultAssetsDir = "/usr/local/kubebuilder/bin"
+
+// WithKubernetesVersion selects the version of the envtest binaries, e.g. 1.29.0 or 1.29.
+// Defaults to $ENVTEST_K8S_VERSION, or the newest version found.
+func WithKubernetesVersion(version string) Option {
+	return func(o *options) {
+		o.k8sVersion = version
+	}
+}
+
+// MissingAssetsError is returned if no complete set of envtest binaries was found.
+type MissingAssetsError struct {
+	// Version requested, empty for any
+	Version string
+	// Dir of the best matching candidate, empty if none matched
+	Dir string
+	// Missing binaries in Dir
+	Missing []string
+	// Searched directories
+	Searched []string
+}
+
+func (e *MissingAssetsError) Error() string {
+	version := e.Version
+	if version == "" {
+		version = "any version"
+	}
+	use := "use --bin-dir bin"
+	if e.Version != "" {
+		use = "use " + e.Version + " --bin-dir bin"
+	}
+	sb := &strings.Builder{}
+	if e.Dir != "" {
+		fmt.Fprintf(sb, "envtest binaries %s missing in %s", strings.Join(e.Missing, ", "), e.Dir)
+	} else {
+		fmt.Fprintf(sb, "no envtest binaries for %s found in %s", version, strings.Join(e.Searched, ", "))
+	}
+	fmt.Fprintf(sb, "\nrun `make envtest && bin/setup-envtest-latest %s` in the module root", use)
+	fmt.Fprintf(sb, " or point KUBEBUILDER_ASSETS to a directory containing %s", strings.Join(assetBinaries, ", "))
+	return sb.String()
+}
+
+// discoverAssets makes sure env finds the envtest binaries.
+// If neither env nor the environment configure them, they are looked up in bin/k8s of the module root
+// and in the setup-envtest store, without downloading anything.
+func discoverAssets(env *envtest.Environment, version string) error {
+	if env.UseExistingCluster != nil && *env.UseExistingCluster {
+		return nil
+	}
+	for _, binary := range assetBinaries {
+		if os.Getenv("TEST_ASSET_"+strings.ToUpper(strings.ReplaceAll(binary, "-", "_"))) != "" {
+			// binaries configured individually, leave it to envtest
+			return nil
+		}
+	}
+	if version == "" {
+		version = os.Getenv("ENVTEST_K8S_VERSION")
+	}
+	for _, dir := range []string{env.BinaryAssetsDirectory, os.Getenv("KUBEBUILDER_ASSETS")} {
+		if dir == "" {
+			continue
+		}
+		if missing := missingBinaries(dir); len(missing) > 0 {
+			return &MissingAssetsError{Version: version, Dir: dir, Missing: missing, Searched: []string{dir}}
+		}
+		return nil
+	}
+	dir, err := findAssets(version, storeDirs())
+	if err != nil {
+		return err
+	}
+	env.BinaryAssetsDirectory = dir
+	return nil
+}
+
+// storeDirs are the directories setup-envtest stores binaries in, named <version>-<os>-<arch>.
+func storeDirs() []string {
+	var dirs []string
+	if root, err := moduleRoot(); err == nil {
+		dirs = append(dirs, filepath.Join(root, "bin", "k8s"))
+	}
+	if dataDir := setupEnvtestDataDir(); dataDir != "" {
+		dirs = append(dirs, filepath.Join(dataDir, "k8s"))
+	}
+	return dirs
+}
+
+// moduleRoot returns the closest parent of the working directory containing a go.mod.
+func moduleRoot() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("no go.mod found")
+		}
+		dir = parent
+	}
+}
+
+// setupEnvtestDataDir mirrors the default store location of setup-envtest.
+func setupEnvtestDataDir() string {
+	home, _ := os.UserHomeDir()
+	switch runtime.GOOS {
+	case "windows":
+		if dir := os.Getenv("LocalAppData"); dir != "" {
+			return filepath.Join(dir, "kubebuilder-envtest")
+		}
+	case "darwin", "ios":
+		if home != "" {
+			return filepath.Join(home, "Library", "Application Support", "io.kubebuilder.envtest")
+		}
+	default:
+		if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+			return filepath.Join(dir, "kubebuilder-envtest")
+		}
+		if home != "" {
+			return filepath.Join(home, ".local", "share", "kubebuilder-envtest")
+		}
+	}
+	return ""
+}
+
+// findAssets returns the directory of the newest version matching version within storeDirs,
+// falling back to envtest's default directory. Without a version, incomplete directories are skipped.
+func findAssets(version string, storeDirs []string) (string, error) {
+	suffix := "-" + runtime.GOOS + "-" + runtime.GOARCH
+	var best, bestVersion, incomplete, incompleteVersion string
+	for _, store := range storeDirs {
+		entries, err := os.ReadDir(store)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			v, ok := strings.CutSuffix(entry.Name(), suffix)
+			if !entry.IsDir() || !ok || !matchesVersion(v, version) {
+				continue
+			}
+			dir := filepath.Join(store, entry.Name())
+			if version == "" && len(missingBinaries(dir)) > 0 {
+				// reported if no complete version is found
+				if incomplete == "" || compareVersions(v, incompleteVersion) > 0 {
+					incomplete, incompleteVersion = dir, v
+				}
+				continue
+			}
+			if best == "" || compareVersions(v, bestVersion) > 0 {
+				best, bestVersion = dir, v
+			}
+		}
+	}
+	searched := append(append([]string(nil), storeDirs...), defaultAssetsDir)
+	if best == "" {
+		if version == "" && len(missingBinaries(defaultAssetsDir)) == 0 {
+			return defaultAssetsDir, nil
+		}
+		if incomplete != "" {
+			return "", &MissingAssetsError{Dir: incomplete, Missing: missingBinaries(incomplete), Searched: searched}
+		}
+		return "", &MissingAssetsError{Version: version, Searched: searched}
+	}
+	if missing := missingBinaries(best); len(missing) > 0 {
+		return "", &MissingAssetsError{Version: version, Dir: best, Missing: missing, Searched: searched}
+	}
+	return best, nil
+}
+
+func missingBinaries(dir string) []string {
+	var missing []string
+	for _, binary := range assetBinaries {
+		if runtime.GOOS == "windows" {
+			binary += ".exe"
+		}
+		if info, err := os.Stat(filepath.Join(dir, binary)); err != nil || info.IsDir() {
+			missing = append(missing, binary)
+		}
+	}
+	return missing
+}
+
+// matchesVersion reports whether v is the wanted version or a patch release of it, e.g. 1.29.0 matches 1.29.
+func matchesVersion(v, want string) bool {
+	return want == "" || v == want || strings.HasPrefix(v, want+".")
+}
+
+// compareVersions compares dotted numeric versions, returning -1, 0 or 1.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < max(len(as), len(bs)); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,92 @@
+package envtesthelper
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_findAssets(t *testing.T) {
+	platform := "-" + runtime.GOOS + "-" + runtime.GOARCH
+	store := t.TempDir()
+	for dir, binaries := range map[string][]string{
+		"1.28.3" + platform: {"etcd", "kube-apiserver", "kubectl"},
+		"1.29.0" + platform: {"etcd", "kube-apiserver", "kubectl"},
+		"1.29.1" + platform: {"etcd", "kube-apiserver", "kubectl"},
+		"1.30.0" + platform: {"kubectl"},
+		"1.31.0-plan9-mips": {"etcd", "kube-apiserver", "kubectl"},
+	} {
+		if err := os.MkdirAll(filepath.Join(store, dir), 0o755); err != nil {
+			t.Fatalf("create dir: %s", err)
+		}
+		for _, binary := range binaries {
+			if runtime.GOOS == "windows" {
+				binary += ".exe"
+			}
+			if err := os.WriteFile(filepath.Join(store, dir, binary), nil, 0o755); err != nil {
+				t.Fatalf("create binary: %s", err)
+			}
+		}
+	}
+
+	tests := []struct {
+		name        string
+		version     string
+		want        string
+		wantMissing []string
+	}{
+		{
+			name:    "exact version",
+			version: "1.28.3",
+			want:    filepath.Join(store, "1.28.3"+platform),
+		},
+		{
+			name:    "newest patch release",
+			version: "1.29",
+			want:    filepath.Join(store, "1.29.1"+platform),
+		},
+		{
+			name: "newest version is incomplete",
+			want: filepath.Join(store, "1.29.1"+platform),
+		},
+		{
+			name:        "requested version is incomplete",
+			version:     "1.30",
+			wantMissing: []string{"etcd", "kube-apiserver"},
+		},
+		{
+			name:    "unknown version",
+			version: "1.27",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := findAssets(tt.version, []string{filepath.Join(store, "missing"), store})
+			if tt.want != "" {
+				if err != nil {
+					t.Fatalf("find assets: %s", err)
+				}
+				if got != tt.want {
+					t.Errorf("got: %s\nwant: %s", got, tt.want)
+				}
+				return
+			}
+			missingErr := &MissingAssetsError{}
+			if !errors.As(err, &missingErr) {
+				t.Fatalf("gotErr: %v\nwant: %T", err, missingErr)
+			}
+			if runtime.GOOS == "windows" {
+				for i := range tt.wantMissing {
+					tt.wantMissing[i] += ".exe"
+				}
+			}
+			if diff := cmp.Diff(missingErr.Missing, tt.wantMissing); diff != "" {
+				t.Errorf("got: %v\nwant: %v\ndiff: %s", missingErr.Missing, tt.wantMissing, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,341 @@
+package envtesthelper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/transport"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// ReconcilerUserAgent identifies the requests of Env.Client, telling them apart from the harness' own requests.
+const ReconcilerUserAgent = "envtesthelper-reconciler"
+
+// ReconcilerUser is the user Env.Client authenticates as with WithAuditLog, a member of system:masters.
+// Without audit log, reconcilers share the admin user of the harness.
+const ReconcilerUser = "envtesthelper-reconciler"
+
+// WithAuditLog starts kube-apiserver with an audit policy logging every request, exposed by Env.AuditEvents.
+// Requires a fresh control plane, so a persistent one is not used.
+func WithAuditLog() Option {
+	return func(o *options) {
+		o.auditLog = true
+	}
+}
+
+// auditPolicy logs all requests including their bodies, but not responses.
+const auditPolicy = `apiVersion: audit.k8s.io/v1
+kind: Policy
+omitStages:
+- RequestReceived
+rules:
+- level: Request
+`
+
+// auditSyncTimeout limits waiting for kube-apiserver to log the requests of a testcase.
+const auditSyncTimeout = 10 * time.Second
+
+// AuditEvent is an audit.k8s.io/v1 Event logged by kube-apiserver, reduced to what is useful in assertions.
+type AuditEvent struct {
+	// AuditID identifies the request, as returned in its Audit-Id response header
+	AuditID types.UID
+	// Verb of the request, e.g. get, list, watch, create, update, patch, delete
+	Verb string
+	// User the request was authenticated as
+	User string
+	// Groups of User
+	Groups []string
+	// UserAgent of the client
+	UserAgent string
+	// Resource the request targeted
+	Resource string
+	// APIGroup of Resource, empty for the core group
+	APIGroup string
+	// APIVersion of Resource
+	APIVersion string
+	// Subresource the request targeted, e.g. status
+	Subresource string
+	// Namespace of the object
+	Namespace string
+	// Name of the object, empty for lists and creates with generateName
+	Name string
+	// Code of the response
+	Code int32
+	// RequestObject sent with the request, e.g. the patch of a patch request
+	RequestObject json.RawMessage
+	// PatchType of patch requests of the reconciler, e.g. application/strategic-merge-patch+json.
+	// The audit log lacks the content type, so it is taken from the requests of Env.Client and Env.Config.
+	PatchType types.PatchType
+}
+
+// auditEvent is the subset of audit.k8s.io/v1 Event parsed.
+type auditEvent struct {
+	AuditID types.UID `json:"auditID"`
+	Verb    string    `json:"verb"`
+	User    struct {
+		Username string   `json:"username"`
+		Groups   []string `json:"groups"`
+	} `json:"user"`
+	UserAgent string `json:"userAgent"`
+	ObjectRef *struct {
+		Resource    string `json:"resource"`
+		Namespace   string `json:"namespace"`
+		Name        string `json:"name"`
+		APIGroup    string `json:"apiGroup"`
+		APIVersion  string `json:"apiVersion"`
+		Subresource string `json:"subresource"`
+	} `json:"objectRef"`
+	ResponseStatus *struct {
+		Code int32 `json:"code"`
+	} `json:"responseStatus"`
+	RequestObject json.RawMessage `json:"requestObject"`
+}
+
+// auditLog is the audit log file of a testenv.
+type auditLog struct {
+	path string
+	// patchTypes are the content types of the reconciler's patch requests by audit ID
+	patchTypes sync.Map
+	// syncs counts the requests of sync, naming them uniquely
+	syncs atomic.Int64
+}
+
+// configureAuditLog makes env's kube-apiserver write its audit log into a temporary directory,
+// which is removed once t completed.
+func configureAuditLog(t testing.TB, env *envtest.Environment) *auditLog {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "envtest-audit-")
+	if err != nil {
+		t.Fatalf("init audit log: %s", err)
+	}
+	t.Cleanup(func() {
+		_ = os.RemoveAll(dir)
+	})
+	policy := filepath.Join(dir, "policy.yaml")
+	if err := os.WriteFile(policy, []byte(auditPolicy), 0o600); err != nil {
+		t.Fatalf("init audit log: %s", err)
+	}
+	l := &auditLog{path: filepath.Join(dir, "audit.log")}
+	env.ControlPlane.GetAPIServer().Configure().
+		Set("audit-policy-file", policy).
+		Set("audit-log-path", l.path).
+		Set("audit-log-format", "json").
+		Set("audit-log-mode", "blocking")
+	return l
+}
+
+// size returns the current size of the log, to read the events logged afterwards from.
+func (l *auditLog) size() (int64, error) {
+	info, err := os.Stat(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("stat audit log: %w", err)
+	}
+	return info.Size(), nil
+}
+
+// sync waits until kube-apiserver logged the requests completed so far, returning the size of the log then.
+// Even in blocking mode, an event is written only after the response was sent,
+// so sync sends a request of its own with c and waits for its event, which follows the earlier ones.
+func (l *auditLog) sync(ctx context.Context, c client.Reader, offset int64) (int64, error) {
+	name := fmt.Sprintf("envtesthelper-audit-sync-%d", l.syncs.Add(1))
+	if err := c.Get(ctx, client.ObjectKey{Name: name}, &corev1.Namespace{}); !apierrors.IsNotFound(err) {
+		return 0, fmt.Errorf("sync audit log: get namespace %s: %v", name, err)
+	}
+	deadline := time.Now().Add(auditSyncTimeout)
+	for {
+		size, err := l.size()
+		if err != nil {
+			return 0, err
+		}
+		events, err := l.events(offset, size)
+		if err != nil {
+			return 0, err
+		}
+		for _, event := range events {
+			if event.Resource == "namespaces" && event.Name == name {
+				return size, nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return 0, fmt.Errorf("sync audit log: request for namespace %s not logged within %s", name, auditSyncTimeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// events parses all events logged after offset, up to end if not 0.
+func (l *auditLog) events(offset, end int64) ([]AuditEvent, error) {
+	f, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read audit log: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("read audit log: %w", err)
+	}
+	r := io.Reader(f)
+	if end > 0 {
+		r = io.LimitReader(f, end-offset)
+	}
+	events, err := parseAuditEvents(r)
+	if err != nil {
+		return nil, err
+	}
+	for i, event := range events {
+		if patchType, ok := l.patchTypes.Load(event.AuditID); ok {
+			events[i].PatchType = patchType.(types.PatchType)
+		}
+	}
+	return events, nil
+}
+
+// recordPatchTypes wraps rt, remembering the content type of patch requests by the audit ID kube-apiserver returns.
+func (l *auditLog) recordPatchTypes(rt http.RoundTripper) http.RoundTripper {
+	return patchTypeRecorder{rt: rt, log: l}
+}
+
+type patchTypeRecorder struct {
+	rt  http.RoundTripper
+	log *auditLog
+}
+
+func (r patchTypeRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.rt.RoundTrip(req)
+	if err != nil || req.Method != http.MethodPatch {
+		return resp, err
+	}
+	if id := resp.Header.Get("Audit-Id"); id != "" {
+		r.log.patchTypes.Store(types.UID(id), types.PatchType(req.Header.Get("Content-Type")))
+	}
+	return resp, nil
+}
+
+func parseAuditEvents(r io.Reader) ([]AuditEvent, error) {
+	var events []AuditEvent
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		raw := auditEvent{}
+		if err := json.Unmarshal(line, &raw); err != nil {
+			// the last line may still be written
+			continue
+		}
+		event := AuditEvent{
+			AuditID:       raw.AuditID,
+			Verb:          raw.Verb,
+			User:          raw.User.Username,
+			Groups:        raw.User.Groups,
+			UserAgent:     raw.UserAgent,
+			RequestObject: raw.RequestObject,
+		}
+		if ref := raw.ObjectRef; ref != nil {
+			event.Resource, event.APIGroup, event.APIVersion = ref.Resource, ref.APIGroup, ref.APIVersion
+			event.Subresource, event.Namespace, event.Name = ref.Subresource, ref.Namespace, ref.Name
+		}
+		if raw.ResponseStatus != nil {
+			event.Code = raw.ResponseStatus.Code
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("parse audit log: %w", err)
+	}
+	return events, nil
+}
+
+// AuditEvents returns the requests kube-apiserver logged for the reconciler during the reconcile loops of the testcase.
+// Requests of the harness, e.g. creating fixtures or checking idempotency, are left out. Requires WithAuditLog.
+func (e *Env) AuditEvents() ([]AuditEvent, error) {
+	if e.audit == nil {
+		return nil, fmt.Errorf("audit log not enabled, see WithAuditLog")
+	}
+	events, err := e.audit.events(e.auditOffset, e.auditEnd)
+	if err != nil {
+		return nil, err
+	}
+	var reconciler []AuditEvent
+	for _, event := range events {
+		if event.UserAgent == ReconcilerUserAgent {
+			reconciler = append(reconciler, event)
+		}
+	}
+	return reconciler, nil
+}
+
+// startAudit marks the start of the events returned by AuditEvents.
+func (e *Env) startAudit() {
+	if e.audit == nil {
+		return
+	}
+	offset, err := e.audit.size()
+	if err != nil {
+		e.T.Errorf("start audit: %s", err)
+	}
+	e.auditOffset, e.auditEnd = offset, 0
+}
+
+// stopAudit marks the end of the events returned by AuditEvents, once kube-apiserver logged all requests made so far.
+func (e *Env) stopAudit(ctx context.Context) {
+	if e.audit == nil {
+		return
+	}
+	end, err := e.audit.sync(ctx, e.harness, e.auditOffset)
+	if err != nil {
+		e.T.Errorf("stop audit: %s", err)
+	}
+	e.auditEnd = end
+}
+
+// reconcilerConfig returns the config of the client handed to reconcilers, identifying as ReconcilerUserAgent,
+// and authenticating as ReconcilerUser if startEnv added it.
+func reconcilerConfig(o *options, cfg *rest.Config) *rest.Config {
+	if o.reconcilerUser != nil {
+		return o.reconcilerUser
+	}
+	rcfg := rest.CopyConfig(cfg)
+	rcfg.UserAgent = ReconcilerUserAgent
+	return rcfg
+}
+
+// addReconcilerUser adds ReconcilerUser to the fresh control plane of env, returning its config based on cfg.
+// Its patch requests are recorded in audit, see AuditEvent.PatchType.
+func addReconcilerUser(t testing.TB, env *envtest.Environment, cfg *rest.Config, audit *auditLog) *rest.Config {
+	t.Helper()
+	user, err := env.AddUser(envtest.User{Name: ReconcilerUser, Groups: []string{"system:masters"}}, &rest.Config{
+		UserAgent:     ReconcilerUserAgent,
+		QPS:           cfg.QPS,
+		Burst:         cfg.Burst,
+		WrapTransport: transport.Wrappers(cfg.WrapTransport, audit.recordPatchTypes),
+	})
+	if err != nil {
+		t.Fatalf("add reconciler user: %s", err)
+	}
+	return user.Config()
+}
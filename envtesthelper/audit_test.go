@@ -0,0 +1,181 @@
+package envtesthelper
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+func Test_parseAuditEvents(t *testing.T) {
+	log := `{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"Request","auditID":"a1","stage":"ResponseComplete","verb":"update","user":{"username":"admin","groups":["system:masters"]},"userAgent":"envtesthelper.test","objectRef":{"resource":"configmaps","namespace":"default","name":"cm","apiVersion":"v1"},"responseStatus":{"code":200},"requestObject":{"kind":"ConfigMap"}}
+{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"Request","stage":"ResponseComplete","verb":"get","user":{"username":"admin"},"objectRef":{"resource":"deployments","namespace":"default","name":"app","apiGroup":"apps","apiVersion":"v1","subresource":"status"},"responseStatus":{"code":404}}
+{"kind":"Event","apiVersion":"audit.k8s.io/v1","verb":"li`
+
+	got, err := parseAuditEvents(strings.NewReader(log))
+	if err != nil {
+		t.Fatalf("parse: %s", err)
+	}
+	want := []AuditEvent{
+		{
+			AuditID:       "a1",
+			Verb:          "update",
+			User:          "admin",
+			Groups:        []string{"system:masters"},
+			UserAgent:     "envtesthelper.test",
+			Resource:      "configmaps",
+			APIVersion:    "v1",
+			Namespace:     "default",
+			Name:          "cm",
+			Code:          200,
+			RequestObject: []byte(`{"kind":"ConfigMap"}`),
+		},
+		{
+			Verb:        "get",
+			User:        "admin",
+			Resource:    "deployments",
+			APIGroup:    "apps",
+			APIVersion:  "v1",
+			Subresource: "status",
+			Namespace:   "default",
+			Name:        "app",
+			Code:        404,
+		},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("diff: %s", diff)
+	}
+}
+
+func Test_RunEnvTest_audit(t *testing.T) {
+	tests := []TestCase[*mockReconciler]{
+		{
+			Name: "updates configmap",
+			Obj:  &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "audited"}},
+			WantSideEffects: func(ctx context.Context, e *Env, r *mockReconciler) {
+				events, err := e.AuditEvents()
+				if err != nil {
+					e.T.Fatal(err)
+				}
+				updated := false
+				for _, event := range events {
+					if event.User != ReconcilerUser || event.UserAgent != ReconcilerUserAgent {
+						e.T.Errorf("got event of %s (%s), want only ones of the reconciler: %+v", event.User, event.UserAgent, event)
+					}
+					if event.Resource == "configmaps" && event.Name == "audited" && event.Verb == "update" && event.Code == 200 {
+						updated = true
+					}
+				}
+				if !updated {
+					e.T.Errorf("no update of configmap audited in %+v", events)
+				}
+			},
+		},
+	}
+	RunEnvTest(
+		t,
+		corev1.AddToScheme,
+		&envtest.Environment{},
+		NewMockReconciler,
+		tests,
+		WithAuditLog(),
+	)
+}
+
+func Test_Env_AuditEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	event := func(verb, userAgent string) string {
+		return `{"verb":"` + verb + `","userAgent":"` + userAgent + `","objectRef":{"resource":"configmaps","name":"cm"}}` + "\n"
+	}
+	before := event("create", "envtesthelper.test")
+	during := event("get", ReconcilerUserAgent) + event("get", "envtesthelper.test") + event("update", ReconcilerUserAgent)
+	after := event("delete", ReconcilerUserAgent)
+	if err := os.WriteFile(path, []byte(before+during+after), 0o600); err != nil {
+		t.Fatalf("write audit log: %s", err)
+	}
+	e := &Env{
+		T:           t,
+		audit:       &auditLog{path: path},
+		auditOffset: int64(len(before)),
+		auditEnd:    int64(len(before + during)),
+	}
+
+	got, err := e.AuditEvents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var verbs []string
+	for _, event := range got {
+		verbs = append(verbs, event.Verb)
+	}
+	if diff := cmp.Diff(verbs, []string{"get", "update"}); diff != "" {
+		t.Errorf("got verbs %v, want the reconciler's during the reconciliation\ndiff: %s", verbs, diff)
+	}
+}
+
+func Test_auditLog_patchTypes(t *testing.T) {
+	l := &auditLog{path: filepath.Join(t.TempDir(), "audit.log")}
+	log := `{"auditID":"a1","verb":"patch","objectRef":{"resource":"configmaps","name":"cm"}}
+{"auditID":"a2","verb":"update","objectRef":{"resource":"configmaps","name":"cm"}}
+`
+	if err := os.WriteFile(l.path, []byte(log), 0o600); err != nil {
+		t.Fatalf("write audit log: %s", err)
+	}
+	rt := l.recordPatchTypes(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Audit-Id": []string{req.URL.Query().Get("id")}}}, nil
+	}))
+	for _, req := range []struct{ method, id string }{{http.MethodPatch, "a1"}, {http.MethodPut, "a2"}} {
+		r, err := http.NewRequest(req.method, "https://apiserver/api/v1/namespaces/default/configmaps/cm?id="+req.id, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Content-Type", "application/strategic-merge-patch+json")
+		if _, err := rt.RoundTrip(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := l.events(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var patchTypes []types.PatchType
+	for _, event := range got {
+		patchTypes = append(patchTypes, event.PatchType)
+	}
+	if diff := cmp.Diff(patchTypes, []types.PatchType{types.StrategicMergePatchType, ""}); diff != "" {
+		t.Errorf("got patch types %v, want the one of the patch only\ndiff: %s", patchTypes, diff)
+	}
+}
+
+func Test_auditLog_sync(t *testing.T) {
+	l := &auditLog{path: filepath.Join(t.TempDir(), "audit.log")}
+	reconciler := `{"verb":"update","userAgent":"` + ReconcilerUserAgent + `","objectRef":{"resource":"configmaps","name":"cm"}}` + "\n"
+	if err := os.WriteFile(l.path, []byte(reconciler), 0o600); err != nil {
+		t.Fatalf("write audit log: %s", err)
+	}
+	// the apiserver logs the sync request a bit later, after further ones of the reconciler
+	logged := reconciler + reconciler + `{"verb":"get","objectRef":{"resource":"namespaces","name":"envtesthelper-audit-sync-1"}}` + "\n"
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = os.WriteFile(l.path, []byte(logged+reconciler), 0o600)
+	}()
+
+	end, err := l.sync(context.Background(), fake.NewClientBuilder().Build(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if end < int64(len(logged)) {
+		t.Errorf("got end %d, want at least %d to include the sync request", end, len(logged))
+	}
+}
@@ -0,0 +1,128 @@
+package envtesthelper
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// RunEnvBenchmark bootstraps a testenv and benchmarks every testcase as a sub benchmark.
+// State and Obj are created once per testcase and deleted once all testcases ran, one op runs all Loops of it.
+// Besides latency and allocations, api-calls/op and writes/op issued by the reconciler are reported.
+// Result and sideeffects of the last op are asserted like RunEnvTest does, CheckIdempotency is ignored.
+// newReconciler is called once per testcase.
+func RunEnvBenchmark[R Reconciler](
+	b *testing.B,
+	addToScheme func(*runtime.Scheme) error,
+	env *envtest.Environment,
+	newReconciler func(e *Env) R,
+	tests []TestCase[R],
+	opts ...Option,
+) {
+	b.Helper()
+	parent := b
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	ctx := context.Background()
+
+	filter, err := newCaseFilter(anyFocus(tests))
+	if err != nil {
+		b.Fatal(err)
+	}
+	c, audit := startEnv(b, o, addToScheme, env)
+	// only distinct calls are kept for the RBAC report, b.N iterations would pile up otherwise
+	recorder := &callRecorder{distinct: true}
+	envs := newEnvFactory(b, o, env.Config, c, recorder, audit)
+
+	for _, tt := range tests {
+		// b.Run calls the sub benchmark repeatedly with a growing b.N, the testcase is seeded on the first call only
+		var e *Env
+		var reconciler R
+		var req ctrl.Request
+		b.Run(tt.Name, func(b *testing.B) {
+			if reason := filter.skipReason(tt.Labels, tt.Skip, tt.Focus); reason != "" {
+				b.Skip(reason)
+			}
+			if e == nil {
+				e, reconciler, req = seedBenchmark(ctx, seedTB{TB: b, parent: parent}, envs, newReconciler, tt)
+			}
+			ctx := e.context(ctx)
+			calls, writes := recorder.counts()
+			e.startAudit()
+
+			var got ctrl.Result
+			var gotErr error
+			b.ReportAllocs()
+			b.ResetTimer()
+			recorder.setEnabled(true)
+			for n := 0; n < b.N; n++ {
+				for i := 0; i < max(1, tt.Loops); i++ {
+					got, gotErr = reconciler.Reconcile(ctx, req)
+				}
+			}
+			recorder.setEnabled(false)
+			b.StopTimer()
+			e.stopAudit(ctx)
+
+			allCalls, allWrites := recorder.counts()
+			b.ReportMetric(float64(allCalls-calls)/float64(b.N), "api-calls/op")
+			b.ReportMetric(float64(allWrites-writes)/float64(b.N), "writes/op")
+
+			if !assertResult(b, got, gotErr, tt.Want, tt.WantErr) {
+				return
+			}
+			if tt.WantSideEffects != nil {
+				tt.WantSideEffects(ctx, e, reconciler)
+			}
+		})
+	}
+	if o.rbacRolePath != "" {
+		reportRBAC(b, o, recorder.Calls())
+	}
+}
+
+// seedBenchmark creates the Env, reconciler and fixtures of tt, returning the request to reconcile.
+func seedBenchmark[R Reconciler](
+	ctx context.Context,
+	t testing.TB,
+	envs *envFactory,
+	newReconciler func(e *Env) R,
+	tt TestCase[R],
+) (*Env, R, ctrl.Request) {
+	t.Helper()
+	e := envs.newEnv(ctx, t)
+	ctx = e.context(ctx)
+	reconciler := newReconciler(e)
+	objs := append([]client.Object(nil), tt.State...)
+	if tt.Obj != nil {
+		objs = append(objs, tt.Obj)
+	}
+	for _, obj := range objs {
+		envs.fixtures.create(ctx, t, obj)
+	}
+	req, err := caseRequest(tt.Obj, tt.Request, e.RunNamespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tt.Delete {
+		deleteObj(ctx, t, envs.fixtures.c, tt.Obj)
+	}
+	return e, reconciler, req
+}
+
+// seedTB fails within TB, but registers cleanups with parent, for fixtures outliving TB.
+// E.g. testing.B runs the cleanups of a sub benchmark every time it calls it again.
+type seedTB struct {
+	testing.TB
+	parent testing.TB
+}
+
+func (t seedTB) Cleanup(f func()) {
+	t.parent.Cleanup(f)
+}
@@ -0,0 +1,64 @@
+package envtesthelper
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+func Benchmark_RunEnvBenchmark(b *testing.B) {
+	tests := []TestCase[*mockReconciler]{
+		{
+			Name: "update",
+			Obj: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "bench-cm",
+				},
+			},
+		},
+	}
+	RunEnvBenchmark(
+		b,
+		corev1.AddToScheme,
+		&envtest.Environment{},
+		NewMockReconciler,
+		tests,
+	)
+}
+
+func Test_callRecorder_distinct(t *testing.T) {
+	recorder := &callRecorder{distinct: true}
+	recorder.setEnabled(true)
+	get := Call{Verb: "get", Resource: schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}, Name: "cm"}
+	update := Call{Verb: "update", Resource: get.Resource, Name: "cm"}
+	for i := 0; i < 3; i++ {
+		recorder.record(get)
+		recorder.record(update)
+	}
+
+	if diff := cmp.Diff(recorder.Calls(), []Call{get, update}); diff != "" {
+		t.Errorf("got calls %v, want distinct ones\ndiff: %s", recorder.Calls(), diff)
+	}
+	if calls, writes := recorder.counts(); calls != 6 || writes != 3 {
+		t.Errorf("got %d calls, %d writes, want 6 calls, 3 writes", calls, writes)
+	}
+}
+
+func Test_seedTB(t *testing.T) {
+	cleanedUp := false
+	t.Run("parent", func(t *testing.T) {
+		t.Run("sub", func(sub *testing.T) {
+			seedTB{TB: sub, parent: t}.Cleanup(func() { cleanedUp = true })
+		})
+		if cleanedUp {
+			t.Error("cleaned up with the sub test, want with the parent")
+		}
+	})
+	if !cleanedUp {
+		t.Error("not cleaned up with the parent")
+	}
+}
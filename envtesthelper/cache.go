@@ -0,0 +1,177 @@
+package envtesthelper
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// WithCachedClient hands reconcilers a client reading from informers like mgr.GetClient() does, instead of
+// reading from the apiserver directly. Watch events reach the informers delay late, which allows to
+// reproduce stale reads after writes. The harness itself keeps reading from the apiserver directly.
+func WithCachedClient(delay time.Duration) Option {
+	return func(o *options) {
+		o.cachedClient = true
+		o.informerDelay = delay
+	}
+}
+
+// index is a field index, as registered by mgr.GetFieldIndexer().IndexField.
+type index struct {
+	obj     client.Object
+	field   string
+	extract client.IndexerFunc
+}
+
+// WithIndex registers a field index, so reconcilers can list obj with client.MatchingFields{field: value}.
+// As the apiserver only supports a few field selectors, this implies WithCachedClient without delay
+// unless given explicitly.
+func WithIndex(obj client.Object, field string, extract client.IndexerFunc) Option {
+	return func(o *options) {
+		o.cachedClient = true
+		o.indexes = append(o.indexes, index{obj: obj, field: field, extract: extract})
+	}
+}
+
+// newReconcilerClient returns the recording client handed to reconcilers, backed by a cache if requested.
+// cfg is the reconciler's own, see reconcilerConfig. harness reads from the apiserver directly.
+func newReconcilerClient(t testing.TB, o *options, cfg *rest.Config, harness client.Client, recorder *callRecorder) client.Client {
+	t.Helper()
+	if !o.cachedClient {
+		c, err := client.New(cfg, client.Options{})
+		if err != nil {
+			t.Fatalf("init reconciler client: %s", err)
+		}
+		return newRecordingClient(c, harness, recorder)
+	}
+
+	cacheCfg := rest.CopyConfig(cfg)
+	if o.informerDelay > 0 {
+		cacheCfg.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return &delayedWatchRoundTripper{RoundTripper: rt, delay: o.informerDelay}
+		})
+	}
+	informers, err := cache.New(cacheCfg, cache.Options{Scheme: scheme.Scheme})
+	if err != nil {
+		t.Fatalf("init cache: %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	for _, i := range o.indexes {
+		if err := informers.IndexField(ctx, i.obj, i.field, i.extract); err != nil {
+			cancel()
+			t.Fatalf("index %T %s: %s", i.obj, i.field, err)
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := informers.Start(ctx); err != nil {
+			t.Errorf("start cache: %s", err)
+		}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	if !informers.WaitForCacheSync(ctx) {
+		t.Fatal("sync cache")
+	}
+
+	cached, err := client.New(cfg, client.Options{Cache: &client.CacheOptions{Reader: informers}})
+	if err != nil {
+		t.Fatalf("init cached client: %s", err)
+	}
+	return newRecordingClient(cached, harness, recorder)
+}
+
+// delayedWatchRoundTripper delays the events of watch responses.
+type delayedWatchRoundTripper struct {
+	http.RoundTripper
+	delay time.Duration
+}
+
+func (rt *delayedWatchRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := rt.RoundTripper.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	switch req.URL.Query().Get("watch") {
+	case "true", "1":
+		resp.Body = newDelayedBody(resp.Body, rt.delay)
+	}
+	return resp, nil
+}
+
+type chunk struct {
+	data []byte
+	at   time.Time
+	err  error
+}
+
+// delayedBody hands out everything read from body not before delay passed since it arrived.
+type delayedBody struct {
+	body    io.ReadCloser
+	delay   time.Duration
+	chunks  chan chunk
+	closed  chan struct{}
+	once    sync.Once
+	pending []byte
+	err     error
+}
+
+func newDelayedBody(body io.ReadCloser, delay time.Duration) *delayedBody {
+	b := &delayedBody{
+		body:   body,
+		delay:  delay,
+		chunks: make(chan chunk, 64),
+		closed: make(chan struct{}),
+	}
+	go b.receive()
+	return b
+}
+
+func (b *delayedBody) receive() {
+	defer close(b.chunks)
+	for {
+		buf := make([]byte, 32*1024)
+		n, err := b.body.Read(buf)
+		select {
+		case b.chunks <- chunk{data: buf[:n], at: time.Now(), err: err}:
+		case <-b.closed:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (b *delayedBody) Read(p []byte) (int, error) {
+	for len(b.pending) == 0 {
+		if b.err != nil {
+			return 0, b.err
+		}
+		c, ok := <-b.chunks
+		if !ok {
+			return 0, io.EOF
+		}
+		time.Sleep(time.Until(c.at.Add(b.delay)))
+		b.pending, b.err = c.data, c.err
+	}
+	n := copy(p, b.pending)
+	b.pending = b.pending[n:]
+	return n, nil
+}
+
+func (b *delayedBody) Close() error {
+	b.once.Do(func() { close(b.closed) })
+	return b.body.Close()
+}
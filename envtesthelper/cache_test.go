@@ -0,0 +1,147 @@
+package envtesthelper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+func Test_delayedBody(t *testing.T) {
+	r, w := io.Pipe()
+	delay := 100 * time.Millisecond
+	body := newDelayedBody(r, delay)
+	defer body.Close()
+
+	start := time.Now()
+	go func() {
+		_, _ = w.Write([]byte(`{"type":"ADDED"}`))
+		_ = w.Close()
+	}()
+	got, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("read body: %s", err)
+	}
+	if string(got) != `{"type":"ADDED"}` {
+		t.Errorf("got: %s\nwant: %s", got, `{"type":"ADDED"}`)
+	}
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Errorf("got event after %s, want at least %s", elapsed, delay)
+	}
+}
+
+func Test_RunEnvTest_cachedClient(t *testing.T) {
+	tests := []TestCase[*staleReadReconciler]{
+		{
+			Name:  "reads own write stale",
+			Obj:   &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "counter"}},
+			Loops: 2,
+			WantSideEffects: func(ctx context.Context, e *Env, r *staleReadReconciler) {
+				if diff := cmp.Diff(r.seen, []string{"", ""}); diff != "" {
+					e.T.Errorf("want the second loop to miss the write of the first one\ndiff: %s", diff)
+				}
+				got := &corev1.ConfigMap{}
+				if err := e.harness.Get(ctx, client.ObjectKey{Namespace: e.RunNamespace, Name: "counter"}, got); err != nil {
+					e.T.Fatal(err)
+				}
+				if got.Data["count"] != "1" {
+					e.T.Errorf("got count %q on the apiserver, want 1", got.Data["count"])
+				}
+			},
+		},
+	}
+	RunEnvTest(
+		t,
+		corev1.AddToScheme,
+		&envtest.Environment{},
+		func(e *Env) *staleReadReconciler { return &staleReadReconciler{Client: e.Client} },
+		tests,
+		WithCachedClient(5*time.Second),
+	)
+}
+
+// staleReadReconciler records the count it reads, and sets it once.
+type staleReadReconciler struct {
+	Client  client.Client
+	seen    []string
+	updated bool
+}
+
+func (r *staleReadReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	cm := &corev1.ConfigMap{}
+	if err := r.Client.Get(ctx, req.NamespacedName, cm); err != nil {
+		return ctrl.Result{}, fmt.Errorf("get counter: %w", err)
+	}
+	r.seen = append(r.seen, cm.Data["count"])
+	if r.updated {
+		return ctrl.Result{}, nil
+	}
+	cm.Data = map[string]string{"count": "1"}
+	if err := r.Client.Update(ctx, cm); err != nil {
+		return ctrl.Result{}, fmt.Errorf("update counter: %w", err)
+	}
+	r.updated = true
+	return ctrl.Result{}, nil
+}
+
+func Test_RunEnvTest_index(t *testing.T) {
+	tests := []TestCase[*ownerIndexReconciler]{
+		{
+			Name: "matching fields",
+			Obj: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "owner"},
+			},
+			State: []client.Object{
+				&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "owned"},
+					Data:       map[string]string{"owner": "owner"},
+				},
+				&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "other"},
+					Data:       map[string]string{"owner": "other"},
+				},
+			},
+			WantSideEffects: func(ctx context.Context, e *Env, r *ownerIndexReconciler) {
+				if len(r.owned) != 1 || r.owned[0] != "owned" {
+					e.T.Errorf("want [owned], got %v", r.owned)
+				}
+			},
+		},
+	}
+	RunEnvTest(
+		t,
+		corev1.AddToScheme,
+		&envtest.Environment{},
+		func(e *Env) *ownerIndexReconciler { return &ownerIndexReconciler{Client: e.Client} },
+		tests,
+		WithIndex(&corev1.ConfigMap{}, "data.owner", func(obj client.Object) []string {
+			return []string{obj.(*corev1.ConfigMap).Data["owner"]}
+		}),
+	)
+}
+
+// ownerIndexReconciler lists the ConfigMaps naming the reconciled one as owner.
+type ownerIndexReconciler struct {
+	Client client.Client
+	owned  []string
+}
+
+func (r *ownerIndexReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	list := &corev1.ConfigMapList{}
+	if err := r.Client.List(ctx, list, client.InNamespace(req.Namespace), client.MatchingFields{"data.owner": req.Name}); err != nil {
+		return ctrl.Result{}, fmt.Errorf("list owned: %w", err)
+	}
+	r.owned = r.owned[:0]
+	for _, cm := range list.Items {
+		r.owned = append(r.owned, cm.Name)
+	}
+	return ctrl.Result{}, nil
+}
@@ -0,0 +1,277 @@
+package envtesthelper
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+// WithCassetteRecording records the REST traffic of the run into a cassette at path, e.g. while running against
+// a real cluster with env.UseExistingCluster. Events and watches are not recorded, so WithCachedClient can't be
+// replayed. Only applies to single cluster runs.
+func WithCassetteRecording(path string) Option {
+	return func(o *options) {
+		o.cassetteRecording = path
+	}
+}
+
+// WithCassetteReplay serves the traffic recorded by WithCassetteRecording instead of starting a testenv.
+// Requests not found in the cassette fail the test, as do recorded requests which were not replayed.
+// Identical requests are answered in recorded order. Only applies to single cluster runs.
+func WithCassetteReplay(path string) Option {
+	return func(o *options) {
+		o.cassetteReplay = path
+	}
+}
+
+// Cassette is recorded REST traffic.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a single recorded request and its response.
+type Interaction struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+// CassetteRequest is matched by all its fields when replaying.
+type CassetteRequest struct {
+	Method string `json:"method"`
+	// URL path and query, without host
+	URL  string       `json:"url"`
+	Body CassetteBody `json:"body,omitempty"`
+}
+
+// CassetteResponse is served when replaying.
+type CassetteResponse struct {
+	StatusCode  int          `json:"statusCode"`
+	ContentType string       `json:"contentType,omitempty"`
+	Body        CassetteBody `json:"body,omitempty"`
+}
+
+// CassetteBody is stored as string, or base64 encoded with a base64: prefix if it is binary, e.g. protobuf.
+type CassetteBody string
+
+func newCassetteBody(data []byte) CassetteBody {
+	if utf8.Valid(data) {
+		return CassetteBody(data)
+	}
+	return CassetteBody("base64:" + base64.StdEncoding.EncodeToString(data))
+}
+
+func (b CassetteBody) bytes() ([]byte, error) {
+	if encoded, ok := strings.CutPrefix(string(b), "base64:"); ok {
+		return base64.StdEncoding.DecodeString(encoded)
+	}
+	return []byte(b), nil
+}
+
+// LoadCassette reads a cassette written by WithCassetteRecording.
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read cassette: %w", err)
+	}
+	cassette := &Cassette{}
+	if err := json.Unmarshal(data, cassette); err != nil {
+		return nil, fmt.Errorf("parse cassette %s: %w", path, err)
+	}
+	return cassette, nil
+}
+
+// skipCassette reports whether req is neither recorded nor replayed strictly:
+// events are emitted asynchronously and watches are streamed.
+func skipCassette(req *http.Request) bool {
+	q := req.URL.Query()
+	return q.Get("watch") == "true" || q.Get("watch") == "1" || strings.HasSuffix(req.URL.Path, "/events") ||
+		strings.Contains(req.URL.Path, "/events/")
+}
+
+// requestURL is the path and normalized query of req.
+func requestURL(req *http.Request) string {
+	if query := req.URL.Query().Encode(); query != "" {
+		return req.URL.Path + "?" + query
+	}
+	return req.URL.Path
+}
+
+// cassetteRecorder records the traffic of all transports it wraps.
+type cassetteRecorder struct {
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// recordCassette wraps the transports of cfg and writes the cassette to path once t completed.
+func recordCassette(t testing.TB, cfg *rest.Config, path string) {
+	r := &cassetteRecorder{}
+	cfg.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return r.roundTrip(rt, req)
+		})
+	})
+	t.Cleanup(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		data, err := json.MarshalIndent(r.cassette, "", "  ")
+		if err != nil {
+			t.Errorf("encode cassette: %s", err)
+			return
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Errorf("write cassette: %s", err)
+			return
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Errorf("write cassette: %s", err)
+		}
+	})
+}
+
+func (r *cassetteRecorder) roundTrip(rt http.RoundTripper, req *http.Request) (*http.Response, error) {
+	if skipCassette(req) {
+		return rt.RoundTrip(req)
+	}
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		if reqBody, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, Interaction{
+		Request: CassetteRequest{Method: req.Method, URL: requestURL(req), Body: newCassetteBody(reqBody)},
+		Response: CassetteResponse{
+			StatusCode:  resp.StatusCode,
+			ContentType: resp.Header.Get("Content-Type"),
+			Body:        newCassetteBody(respBody),
+		},
+	})
+	return resp, nil
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// replayServer answers requests from a cassette.
+type replayServer struct {
+	t        testing.TB
+	mu       sync.Mutex
+	cassette *Cassette
+	used     []bool
+}
+
+// startReplay serves the cassette at path and returns a config for it.
+// The server is stopped once t completed, failing t if recorded requests were not replayed.
+func startReplay(t testing.TB, path string) *rest.Config {
+	t.Helper()
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		t.Fatalf("init replay: %s", err)
+	}
+	s := &replayServer{t: t, cassette: cassette, used: make([]bool, len(cassette.Interactions))}
+	srv := httptest.NewServer(s)
+	t.Cleanup(func() {
+		srv.Close()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		var unused []string
+		for i, used := range s.used {
+			if !used {
+				req := s.cassette.Interactions[i].Request
+				unused = append(unused, req.Method+" "+req.URL)
+			}
+		}
+		if len(unused) > 0 {
+			t.Errorf("recorded requests not replayed from %s:\n%s", path, strings.Join(unused, "\n"))
+		}
+	})
+	return &rest.Config{Host: srv.URL}
+}
+
+func (s *replayServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		s.fail(w, fmt.Sprintf("read request: %s", err))
+		return
+	}
+	if skipCassette(req) {
+		if req.URL.Query().Get("watch") != "" {
+			s.fail(w, "watches can't be replayed")
+			return
+		}
+		// accept events as sent
+		w.Header().Set("Content-Type", req.Header.Get("Content-Type"))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write(body)
+		return
+	}
+
+	want := CassetteRequest{Method: req.Method, URL: requestURL(req), Body: newCassetteBody(body)}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, interaction := range s.cassette.Interactions {
+		if s.used[i] || interaction.Request != want {
+			continue
+		}
+		s.used[i] = true
+		respBody, err := interaction.Response.Body.bytes()
+		if err != nil {
+			s.fail(w, fmt.Sprintf("decode recorded response: %s", err))
+			return
+		}
+		if interaction.Response.ContentType != "" {
+			w.Header().Set("Content-Type", interaction.Response.ContentType)
+		}
+		w.WriteHeader(interaction.Response.StatusCode)
+		_, _ = w.Write(respBody)
+		return
+	}
+	s.fail(w, fmt.Sprintf("unexpected request %s %s %s", want.Method, want.URL, want.Body))
+}
+
+// fail fails the test and answers with an internal error, so the client sees it as well.
+func (s *replayServer) fail(w http.ResponseWriter, msg string) {
+	s.t.Errorf("replay: %s", msg)
+	status := metav1.Status{
+		TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+		Status:   metav1.StatusFailure,
+		Message:  msg,
+		Reason:   metav1.StatusReasonInternalError,
+		Code:     http.StatusInternalServerError,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusInternalServerError)
+	_ = json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,72 @@
+package envtesthelper
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+// errorCapturingTB records errors instead of failing the test.
+type errorCapturingTB struct {
+	testing.TB
+	mu     sync.Mutex
+	errors []string
+}
+
+func (t *errorCapturingTB) Errorf(format string, args ...any) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.errors = append(t.errors, format)
+}
+
+func Test_cassette(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	cluster := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"kind":"ConfigMap","metadata":{"name":"`+req.URL.Query().Get("name")+`"}}`)
+	}))
+	defer cluster.Close()
+
+	get := func(t *testing.T, cfg *rest.Config, query string) (int, string) {
+		hc, err := rest.HTTPClientFor(cfg)
+		if err != nil {
+			t.Fatalf("init http client: %s", err)
+		}
+		resp, err := hc.Get(cfg.Host + "/api/v1/namespaces/default/configmaps?" + query)
+		if err != nil {
+			t.Fatalf("get: %s", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	t.Run("record", func(t *testing.T) {
+		cfg := &rest.Config{Host: cluster.URL}
+		recordCassette(t, cfg, path)
+		get(t, cfg, "name=a")
+		get(t, cfg, "name=b")
+	})
+
+	replayT := &errorCapturingTB{}
+	t.Run("replay", func(t *testing.T) {
+		replayT.TB = t
+		cfg := startReplay(replayT, path)
+		if code, body := get(t, cfg, "name=b"); code != http.StatusOK || !strings.Contains(body, `"name":"b"`) {
+			t.Errorf("got %d %s, want recorded response", code, body)
+		}
+		if code, _ := get(t, cfg, "name=c"); code != http.StatusInternalServerError {
+			t.Errorf("got %d for unexpected request, want %d", code, http.StatusInternalServerError)
+		}
+	})
+	want := []string{"replay: %s", "recorded requests not replayed from %s:\n%s"}
+	if strings.Join(replayT.errors, ",") != strings.Join(want, ",") {
+		t.Errorf("got errors: %q\nwant: %q", replayT.errors, want)
+	}
+}
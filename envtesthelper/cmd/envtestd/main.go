@@ -0,0 +1,41 @@
+// envtestd runs a long-lived envtest control plane, which envtesthelper reuses when
+// ENVTEST_PERSISTENT=true is set or WithPersistentControlPlane is passed.
+//
+//	go run github.com/gfelbing/ginkgoless-kubebuilder/envtesthelper/cmd/envtestd -crd-dir config/crd/bases
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/gfelbing/ginkgoless-kubebuilder/envtesthelper"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+func main() {
+	var crdDirs []string
+	var k8sVersion string
+	flag.Func("crd-dir", "Directory or file containing CRDs to install, may be repeated.", func(dir string) error {
+		crdDirs = append(crdDirs, dir)
+		return nil
+	})
+	flag.StringVar(&k8sVersion, "k8s-version", "", "Version of the envtest binaries, defaults to $ENVTEST_K8S_VERSION or the newest found.")
+	flag.Parse()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	env := &envtest.Environment{
+		CRDDirectoryPaths:     crdDirs,
+		ErrorIfCRDPathMissing: true,
+	}
+	fmt.Println("serving control plane, kubeconfig:", envtesthelper.PersistentKubeconfig())
+	if err := envtesthelper.ServePersistentControlPlane(ctx, env, envtesthelper.WithKubernetesVersion(k8sVersion)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,142 @@
+package envtesthelper
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"testing"
+	"time"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// cancelGrace is how long a reconciler may take to return once its context is done.
+var cancelGrace = 5 * time.Second
+
+// WithTimeout limits the time all reconciliations of a testcase may take together,
+// unless the testcase sets its own Timeout.
+// Defaults to shortly before the deadline of go test -timeout, so hanging testcases are reported instead of panicking.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.caseTimeout = d
+	}
+}
+
+// WithReconcileTimeout limits the time a single reconciliation loop may take.
+func WithReconcileTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.reconcileTimeout = d
+	}
+}
+
+// caseContext returns the context for the reconciliations of a testcase, limited by timeout or the deadline of t.
+func caseContext(ctx context.Context, t *testing.T, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	if deadline, ok := t.Deadline(); ok {
+		// leave time to report a hanging reconciler and clean up
+		return context.WithDeadline(ctx, deadline.Add(-2*cancelGrace))
+	}
+	return context.WithCancel(ctx)
+}
+
+// reconcile runs a single loop of r, limited by timeout if set.
+// If r keeps running for cancelGrace after the context is done, t fails with the stack of the stuck reconciliation,
+// and the stacks of all goroutines are written to the artifacts of the testcase.
+func reconcile(ctx context.Context, t testing.TB, r Reconciler, req ctrl.Request, timeout time.Duration) (ctrl.Result, error) {
+	t.Helper()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	type outcome struct {
+		res   ctrl.Result
+		err   error
+		panic string
+	}
+	id := make(chan string, 1)
+	done := make(chan outcome, 1)
+	go func() {
+		var o outcome
+		defer func() {
+			// hand panics over to the test goroutine, which would have seen them without the timeout
+			if p := recover(); p != nil {
+				o.panic = fmt.Sprintf("%v\n\n%s", p, debug.Stack())
+			}
+			done <- o
+		}()
+		id <- goroutineID()
+		o.res, o.err = r.Reconcile(ctx, req)
+	}()
+	goroutine := <-id
+
+	var o outcome
+	select {
+	case o = <-done:
+	case <-ctx.Done():
+		select {
+		case o = <-done:
+			t.Errorf("reconcile %s did not finish in time: %s", req, ctx.Err())
+		case <-time.After(cancelGrace):
+			failStuck(t, req, ctx.Err(), goroutine)
+		}
+	}
+	if o.panic != "" {
+		panic(o.panic)
+	}
+	return o.res, o.err
+}
+
+// failStuck fails t with the stack of the goroutine running the reconciliation of req,
+// and writes the stacks of all goroutines to the artifacts of the testcase.
+func failStuck(t testing.TB, req ctrl.Request, cause error, goroutine string) {
+	t.Helper()
+	stacks := allStacks()
+	if path, err := writeArtifact(t, "goroutines.txt", stacks); err != nil {
+		t.Logf("write goroutines: %s", err)
+	} else {
+		t.Logf("stacks of all goroutines written to %s", path)
+	}
+	t.Fatalf("reconcile %s ignores its context, still running %s after it was done (%s):\n%s",
+		req, cancelGrace, cause, goroutineStack(stacks, goroutine))
+}
+
+// goroutineID returns the id of the calling goroutine, as shown in stack traces.
+func goroutineID() string {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	// "goroutine 42 [running]:"
+	fields := bytes.Fields(buf)
+	if len(fields) < 2 {
+		return ""
+	}
+	return string(fields[1])
+}
+
+// allStacks returns the stacks of all goroutines.
+func allStacks() []byte {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// goroutineStack picks the stack of goroutine id out of stacks.
+func goroutineStack(stacks []byte, id string) string {
+	prefix := []byte(fmt.Sprintf("goroutine %s ", id))
+	for _, stack := range bytes.Split(stacks, []byte("\n\n")) {
+		if bytes.HasPrefix(stack, prefix) {
+			return string(stack)
+		}
+	}
+	return fmt.Sprintf("goroutine %s not found", id)
+}
@@ -0,0 +1,111 @@
+package envtesthelper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// fatalCapturingTB records errors and fatal errors instead of failing the test.
+type fatalCapturingTB struct {
+	errorCapturingTB
+	fatal string
+}
+
+func (t *fatalCapturingTB) Fatalf(format string, args ...any) {
+	t.fatal = fmt.Sprintf(format, args...)
+	runtime.Goexit()
+}
+
+func (t *fatalCapturingTB) Fatal(args ...any) {
+	t.fatal = fmt.Sprint(args...)
+	runtime.Goexit()
+}
+
+// sleepReconciler waits for its context to be done, or for release if it ignores it.
+type sleepReconciler struct {
+	ignoreCtx bool
+	release   chan struct{}
+}
+
+func (r *sleepReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	if r.ignoreCtx {
+		<-r.release
+		return ctrl.Result{}, nil
+	}
+	<-ctx.Done()
+	return ctrl.Result{}, ctx.Err()
+}
+
+func Test_reconcile(t *testing.T) {
+	t.Setenv("ARTIFACTS", t.TempDir())
+	cancelGrace = 50 * time.Millisecond
+	defer func() { cancelGrace = 5 * time.Second }()
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "obj", Namespace: "default"}}
+
+	tests := []struct {
+		name      string
+		ignoreCtx bool
+		wantErr   error
+		wantError bool
+		wantFatal string
+	}{
+		{
+			name:      "timeout",
+			wantErr:   context.DeadlineExceeded,
+			wantError: true,
+		},
+		{
+			name:      "ignores cancellation",
+			ignoreCtx: true,
+			wantFatal: "sleepReconciler",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &sleepReconciler{ignoreCtx: tt.ignoreCtx, release: make(chan struct{})}
+			defer close(r.release)
+			tb := &fatalCapturingTB{errorCapturingTB: errorCapturingTB{TB: t}}
+
+			var gotErr error
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				_, gotErr = reconcile(context.Background(), tb, r, req, 10*time.Millisecond)
+			}()
+			<-done
+
+			if !errors.Is(gotErr, tt.wantErr) {
+				t.Errorf("gotErr: %s\nwant: %s", gotErr, tt.wantErr)
+			}
+			if got := len(tb.errors) > 0; got != tt.wantError {
+				t.Errorf("got errors %v, want errors %v", tb.errors, tt.wantError)
+			}
+			if (tt.wantFatal == "") != (tb.fatal == "") || !strings.Contains(tb.fatal, tt.wantFatal) {
+				t.Errorf("got fatal %q, want it to contain %q", tb.fatal, tt.wantFatal)
+			}
+		})
+	}
+}
+
+func Test_reconcile_panic(t *testing.T) {
+	defer func() {
+		if p := recover(); p == nil || !strings.Contains(fmt.Sprint(p), "boom") {
+			t.Errorf("got panic %v, want boom", p)
+		}
+	}()
+	_, _ = reconcile(context.Background(), t, panicReconciler{}, ctrl.Request{}, 0)
+}
+
+type panicReconciler struct{}
+
+func (panicReconciler) Reconcile(context.Context, ctrl.Request) (ctrl.Result, error) {
+	panic("boom")
+}
@@ -0,0 +1,221 @@
+package envtesthelper
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	"sigs.k8s.io/yaml"
+)
+
+// serverOutput captures the output of a testenv's kube-apiserver and etcd.
+type serverOutput struct {
+	apiserver syncBuffer
+	etcd      syncBuffer
+}
+
+// captureServerOutput tees the output of the control plane env is going to start, nil if it uses an existing cluster.
+func captureServerOutput(env *envtest.Environment) *serverOutput {
+	if env.UseExistingCluster != nil && *env.UseExistingCluster {
+		return nil
+	}
+	attach := env.AttachControlPlaneOutput || os.Getenv("KUBEBUILDER_ATTACH_CONTROL_PLANE_OUTPUT") == "true"
+	tee := func(w, std io.Writer, buf *syncBuffer) io.Writer {
+		if w == nil && attach {
+			w = std
+		}
+		if w == nil {
+			return buf
+		}
+		return io.MultiWriter(w, buf)
+	}
+	out := &serverOutput{}
+	apiServer := env.ControlPlane.GetAPIServer()
+	apiServer.Out = tee(apiServer.Out, os.Stdout, &out.apiserver)
+	apiServer.Err = tee(apiServer.Err, os.Stderr, &out.apiserver)
+	if env.ControlPlane.Etcd == nil {
+		env.ControlPlane.Etcd = &envtest.Etcd{}
+	}
+	env.ControlPlane.Etcd.Out = tee(env.ControlPlane.Etcd.Out, os.Stdout, &out.etcd)
+	env.ControlPlane.Etcd.Err = tee(env.ControlPlane.Etcd.Err, os.Stderr, &out.etcd)
+	return out
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Len()
+}
+
+// since returns everything written after the first offset bytes.
+func (b *syncBuffer) since(offset int) []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf.Bytes()[min(offset, b.buf.Len()):]...)
+}
+
+// dumpOnFailure writes the state of the testcase running in t to its artifacts directory, if it fails:
+// all objects in the namespaces returned by touched, their events, the reconciler logs and the control plane
+// output since the testcase started.
+func dumpOnFailure(t testing.TB, c client.Client, cfg *rest.Config, touched func() []string, logs *caseLogs, out *serverOutput) {
+	var apiserverOffset, etcdOffset int
+	if out != nil {
+		apiserverOffset, etcdOffset = out.apiserver.Len(), out.etcd.Len()
+	}
+	t.Cleanup(func() {
+		if !t.Failed() {
+			return
+		}
+		dir, err := caseArtifactsDir(t)
+		if err != nil {
+			t.Log(err)
+			return
+		}
+		ctx := context.Background()
+		namespaces := touched()
+		artifacts := map[string][]byte{
+			"reconciler.log": []byte(strings.Join(logs.lines(), "\n")),
+		}
+		objects, err := dumpObjects(ctx, c, cfg, namespaces)
+		if err != nil {
+			t.Logf("dump objects: %s", err)
+		}
+		artifacts["objects.yaml"] = objects
+		events, err := dumpEvents(ctx, c, namespaces)
+		if err != nil {
+			t.Logf("dump events: %s", err)
+		}
+		artifacts["events.log"] = events
+		if out != nil {
+			artifacts["kube-apiserver.log"] = out.apiserver.since(apiserverOffset)
+			artifacts["etcd.log"] = out.etcd.since(etcdOffset)
+		}
+
+		for _, name := range sortedKeys(artifacts) {
+			if _, err := writeArtifact(t, name, artifacts[name]); err != nil {
+				t.Log(err)
+				return
+			}
+		}
+		t.Logf("artifacts of failed testcase written to %s", dir)
+	})
+}
+
+// dumpObjects renders all listable objects in namespaces as YAML.
+func dumpObjects(ctx context.Context, c client.Client, cfg *rest.Config, namespaces []string) ([]byte, error) {
+	dc, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("init discovery: %w", err)
+	}
+	// partial results are still worth dumping, e.g. if an aggregated api is unavailable
+	resources, discoveryErr := dc.ServerPreferredNamespacedResources()
+	var docs []string
+	var errs []string
+	for _, ns := range namespaces {
+		for _, list := range resources {
+			for _, resource := range list.APIResources {
+				if resource.Kind == "Event" || !slices.Contains(resource.Verbs, "list") {
+					continue
+				}
+				gv, err := schema.ParseGroupVersion(list.GroupVersion)
+				if err != nil {
+					continue
+				}
+				objs := &unstructured.UnstructuredList{}
+				objs.SetGroupVersionKind(gv.WithKind(resource.Kind + "List"))
+				if err := c.List(ctx, objs, client.InNamespace(ns)); err != nil {
+					errs = append(errs, fmt.Sprintf("list %s in %s: %s", resource.Name, ns, err))
+					continue
+				}
+				for _, obj := range objs.Items {
+					unstructured.RemoveNestedField(obj.Object, "metadata", "managedFields")
+					doc, err := yaml.Marshal(obj.Object)
+					if err != nil {
+						errs = append(errs, fmt.Sprintf("encode %s %s/%s: %s", resource.Kind, ns, obj.GetName(), err))
+						continue
+					}
+					docs = append(docs, string(doc))
+				}
+			}
+		}
+	}
+	if discoveryErr != nil {
+		errs = append(errs, discoveryErr.Error())
+	}
+	if len(errs) > 0 {
+		err = fmt.Errorf("%s", strings.Join(errs, "\n"))
+	}
+	return []byte(strings.Join(docs, "---\n")), err
+}
+
+// dumpEvents renders the events in namespaces, one per line in order of occurrence.
+func dumpEvents(ctx context.Context, c client.Client, namespaces []string) ([]byte, error) {
+	var events []corev1.Event
+	for _, ns := range namespaces {
+		list := &corev1.EventList{}
+		if err := c.List(ctx, list, client.InNamespace(ns)); err != nil {
+			return nil, fmt.Errorf("list events in %s: %w", ns, err)
+		}
+		events = append(events, list.Items...)
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return eventTime(events[i]).Before(eventTime(events[j]))
+	})
+	sb := &strings.Builder{}
+	for _, e := range events {
+		fmt.Fprintf(sb, "%s %s %s %s %s/%s: %s\n", eventTime(e).Format("15:04:05.000"), e.Type, e.Reason,
+			e.InvolvedObject.Kind, e.InvolvedObject.Namespace, e.InvolvedObject.Name, e.Message)
+	}
+	return []byte(sb.String()), nil
+}
+
+func eventTime(e corev1.Event) time.Time {
+	switch {
+	case !e.EventTime.IsZero():
+		return e.EventTime.Time
+	case !e.LastTimestamp.IsZero():
+		return e.LastTimestamp.Time
+	case !e.FirstTimestamp.IsZero():
+		return e.FirstTimestamp.Time
+	}
+	return e.CreationTimestamp.Time
+}
+
+// touchedNamespaces returns namespace and the namespaces of all objects tracked by tl or accessed by calls.
+func touchedNamespaces(namespace string, tl *timeline, calls []Call) []string {
+	namespaces := map[string]bool{namespace: true}
+	for _, ref := range tl.refs {
+		namespaces[ref.key.Namespace] = true
+	}
+	for _, call := range calls {
+		namespaces[call.Namespace] = true
+	}
+	delete(namespaces, "")
+	return sortedKeys(namespaces)
+}
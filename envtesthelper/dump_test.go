@@ -0,0 +1,114 @@
+package envtesthelper
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_touchedNamespaces(t *testing.T) {
+	tl := newTimeline(fake.NewClientBuilder().Build())
+	tl.refs = []objectRef{
+		{key: client.ObjectKey{Name: "ns"}},
+		{key: client.ObjectKey{Namespace: "fixtures", Name: "cm"}},
+	}
+	calls := []Call{{Verb: "list", Namespace: "listed"}, {Verb: "list"}}
+
+	got := touchedNamespaces("run", tl, calls)
+	if diff := cmp.Diff(got, []string{"fixtures", "listed", "run"}); diff != "" {
+		t.Errorf("got: %v\ndiff: %s", got, diff)
+	}
+}
+
+func Test_dumpEvents(t *testing.T) {
+	now := time.Now()
+	event := func(name, reason string, at time.Time) *corev1.Event {
+		return &corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: name, Namespace: "default"},
+			InvolvedObject: corev1.ObjectReference{Kind: "ConfigMap", Namespace: "default", Name: "cm"},
+			Type:           corev1.EventTypeNormal,
+			Reason:         reason,
+			Message:        reason + " cm",
+			LastTimestamp:  metav1.NewTime(at),
+		}
+	}
+	c := fake.NewClientBuilder().WithObjects(
+		event("b", "Updated", now),
+		event("a", "Created", now.Add(-time.Second)),
+	).Build()
+
+	got, err := dumpEvents(context.Background(), c, []string{"default"})
+	if err != nil {
+		t.Fatalf("dump events: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(got)), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], "Normal Created ConfigMap default/cm: Created cm") ||
+		!strings.HasSuffix(lines[1], "Normal Updated ConfigMap default/cm: Updated cm") {
+		t.Errorf("got events:\n%s", got)
+	}
+}
+
+func Test_syncBuffer_since(t *testing.T) {
+	b := &syncBuffer{}
+	_, _ = b.Write([]byte("before\n"))
+	offset := b.Len()
+	_, _ = b.Write([]byte("during\n"))
+	if got := string(b.since(offset)); got != "during\n" {
+		t.Errorf("got: %q\nwant: %q", got, "during\n")
+	}
+}
+
+func Test_caseDir(t *testing.T) {
+	tests := map[string]string{
+		"Test_Reconcile/valid":        filepath.Join("Test_Reconcile", "valid"),
+		"Test_Reconcile/spec'd_to#01": filepath.Join("Test_Reconcile", "spec_d_to_01"),
+		"Test_Reconcile/..":           filepath.Join("Test_Reconcile", "__"),
+		"Test_Reconcile/../../etc":    filepath.Join("Test_Reconcile", "__", "__", "etc"),
+		"Test_Reconcile/.":            filepath.Join("Test_Reconcile", "_"),
+		"Test_Reconcile//x":           filepath.Join("Test_Reconcile", "_", "x"),
+		"Test_Reconcile/.hidden":      filepath.Join("Test_Reconcile", ".hidden"),
+	}
+	for name, want := range tests {
+		if got := caseDir(name); got != want {
+			t.Errorf("caseDir(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func Test_writeArtifact(t *testing.T) {
+	t.Setenv("ARTIFACTS", "")
+	path, err := writeArtifact(t, "timeline.txt", []byte("loop 1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(filepath.Dir(path)) })
+	if !strings.Contains(filepath.Base(filepath.Dir(path)), "Test_writeArtifact") {
+		t.Errorf("got %s, want a temporary directory of the testcase", path)
+	}
+	again, err := writeArtifact(t, "events.log", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(again) != filepath.Dir(path) {
+		t.Errorf("got %s, want it next to %s", again, path)
+	}
+
+	dir := t.TempDir()
+	t.Setenv("ARTIFACTS", dir)
+	path, err = writeArtifact(t, "timeline.txt", []byte("loop 1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "Test_writeArtifact", "timeline.txt"); path != want {
+		t.Errorf("got %s, want %s", path, want)
+	}
+}
@@ -0,0 +1,159 @@
+package envtesthelper
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/testr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Env is the environment of a testcase, handed to the reconciler factory and sideeffect assertions.
+type Env struct {
+	// T of the running testcase
+	T testing.TB
+	// Client for the reconciler, its requests are recorded for RBAC reports and idempotency checks
+	Client client.Client
+	// Scheme the controller scheme was added to
+	Scheme *runtime.Scheme
+	// Config of the testenv's apiserver, identifying as the reconciler like Client
+	Config *rest.Config
+	// Recorder emitting events to the apiserver, like mgr.GetEventRecorderFor
+	Recorder record.EventRecorder
+	// Clock for the reconciler, see WithClock
+	Clock clock.Clock
+	// Logger writing to T, also passed to Reconcile within the context
+	Logger logr.Logger
+	// RunNamespace is unique to the run, namespaced fixtures without a namespace are created in it.
+	// It is shared by all testcases of the run: objects the reconciler creates stay for later testcases,
+	// unless WantSideEffects deletes them.
+	RunNamespace string
+	// Clusters are the clients for the reconciler by cluster name, only set by RunMultiClusterEnvTest.
+	// Client is the one of the cluster of the testcase.
+	Clusters map[string]client.Client
+
+	// harness reads from the apiserver directly, unlike a cached Client
+	harness     client.Client
+	logs        *caseLogs
+	audit       *auditLog
+	auditOffset int64
+	// auditEnd limits the events returned by AuditEvents, 0 until the reconciliation completed
+	auditEnd int64
+}
+
+// WithClock hands c to reconcilers as Env.Clock, e.g. a k8s.io/utils/clock/testing.FakeClock.
+// Defaults to the real clock.
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// envFactory creates an Env per testcase, sharing the clients and event broadcaster of a testenv.
+type envFactory struct {
+	config *rest.Config
+	// reconcilerConfig identifies as the reconciler, see ReconcilerUserAgent
+	reconcilerConfig *rest.Config
+	client           client.Client
+	fixtures         *fixtureSet
+	broadcaster      record.EventBroadcaster
+	clock            clock.Clock
+	audit            *auditLog
+}
+
+func newEnvFactory(
+	t testing.TB,
+	o *options,
+	cfg *rest.Config,
+	c client.Client,
+	recorder *callRecorder,
+	audit *auditLog,
+) *envFactory {
+	t.Helper()
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		t.Fatalf("init clientset: %s", err)
+	}
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	t.Cleanup(broadcaster.Shutdown)
+
+	clk := o.clock
+	if clk == nil {
+		clk = clock.RealClock{}
+	}
+	fixtures := newFixtureSet(t, c)
+	fixtures.shared = o.shared
+	rcfg := reconcilerConfig(o, cfg)
+	return &envFactory{
+		config:           cfg,
+		reconcilerConfig: rcfg,
+		// the reconciler gets a recording client, the harness itself uses the plain one
+		client:      newReconcilerClient(t, o, rcfg, c, recorder),
+		fixtures:    fixtures,
+		broadcaster: broadcaster,
+		clock:       clk,
+		audit:       audit,
+	}
+}
+
+func (f *envFactory) newEnv(ctx context.Context, t testing.TB) *Env {
+	t.Helper()
+	logs := &caseLogs{}
+	return &Env{
+		T:            t,
+		Client:       f.client,
+		Scheme:       scheme.Scheme,
+		Config:       f.reconcilerConfig,
+		Recorder:     f.broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "envtesthelper"}),
+		Clock:        f.clock,
+		Logger:       testr.NewWithInterface(logTee{TB: t, logs: logs}, testr.Options{}),
+		RunNamespace: f.fixtures.runNamespace(ctx, t),
+		harness:      f.fixtures.c,
+		logs:         logs,
+		audit:        f.audit,
+	}
+}
+
+// context returns ctx carrying the logger of e, so log.FromContext works within Reconcile.
+func (e *Env) context(ctx context.Context) context.Context {
+	return logr.NewContext(ctx, e.Logger)
+}
+
+// caseLogs captures the logs of Env.Logger for reports and artifacts.
+type caseLogs struct {
+	mu   sync.Mutex
+	logs []string
+}
+
+func (l *caseLogs) lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.logs...)
+}
+
+// logTee is the testr.TestingT of Env.Logger, logging to the test and capturing into logs.
+type logTee struct {
+	testing.TB
+	logs *caseLogs
+}
+
+func (l logTee) Log(args ...any) {
+	l.TB.Helper()
+	l.TB.Log(args...)
+	l.logs.mu.Lock()
+	defer l.logs.mu.Unlock()
+	l.logs.logs = append(l.logs.logs, strings.TrimSuffix(fmt.Sprintln(args...), "\n"))
+}
@@ -3,11 +3,20 @@ package envtesthelper
 import (
 	"context"
 	"errors"
+	"fmt"
+	"os"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/utils/clock"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
@@ -20,8 +29,12 @@ type Reconciler interface {
 type TestCase[R Reconciler] struct {
 	// Name of the testcase
 	Name string
-	// Obj to reconcile
+	// Obj to reconcile, may be nil if Request is set
 	Obj client.Object
+	// Request to reconcile, defaults to the key of Obj.
+	// Set it to reconcile absent objects, or objects mapped from Obj.
+	// Without a namespace, it targets the namespace of Obj, or the run namespace without Obj.
+	Request *ctrl.Request
 	// Previous state in cluster
 	State []client.Object
 	// Amount of reconciliation loops, defaults to 1
@@ -30,87 +43,452 @@ type TestCase[R Reconciler] struct {
 	Want ctrl.Result
 	// Desired error after all loops
 	WantErr error
-	// Sideeffects to assert after reconciliation. Objects created by controller should be cleaned up here.
-	WantSideEffects func(ctx context.Context, r R) error
+	// Fail if one more reconciliation after all loops writes to the cluster, defaults to WithIdempotencyCheck.
+	// Skipped if the last loop failed or requested a requeue.
+	CheckIdempotency *bool
+	// Delete Obj after creating it, so the reconciler sees it with a DeletionTimestamp.
+	// Obj needs a finalizer to not be gone right away, see BlockingFinalizer.
+	Delete bool
+	// Sideeffects to assert after reconciliation, failures are reported with e.T.
+	// Objects created by controller should be cleaned up here.
+	WantSideEffects func(ctx context.Context, e *Env, r R)
+	// Labels to select testcases by with -envtest.label-filter
+	Labels []string
+	// Skip the testcase
+	Skip bool
+	// Focus the testcase, skipping all testcases without Focus
+	Focus bool
+	// Time all reconciliations may take together, defaults to WithTimeout
+	Timeout time.Duration
+}
+
+// Option configures optional behaviour of RunEnvTest.
+type Option func(*options)
+
+type options struct {
+	rbacRolePath string
+	rbacMarkers  bool
+	k8sVersion   string
+	persistent   bool
+	// set by startEnv if it connected to a persistent control plane
+	shared bool
+	// set by startEnv if it added ReconcilerUser
+	reconcilerUser *rest.Config
+
+	idempotencyCheck bool
+	shuffleSeed      *int64
+
+	cachedClient  bool
+	informerDelay time.Duration
+	indexes       []index
+
+	clock clock.Clock
+
+	cassetteRecording string
+	cassetteReplay    string
+
+	auditLog bool
+
+	caseTimeout      time.Duration
+	reconcileTimeout time.Duration
+
+	leakCheck  bool
+	leakIgnore []string
 }
 
 // RunEnvTest bootstraps a testenv and executes all given testcases.
 // addToScheme be used to add the controller scheme, e.g. by passing yourapiv1.AddToScheme
+// newReconciler is called once per testcase.
 func RunEnvTest[R Reconciler](
 	t *testing.T,
 	addToScheme func(*runtime.Scheme) error,
 	env *envtest.Environment,
-	newReconciler func(client.Client) R,
+	newReconciler func(e *Env) R,
 	tests []TestCase[R],
+	opts ...Option,
 ) {
 	t.Helper()
-	// prepare context, scheme, fakeclient and reconciler
-	ctx := context.Background()
+	r := newRunner(t, addToScheme, env, newReconciler, anyFocus(tests), opts)
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			r.run(t, tt, nil, nil)
+		})
+	}
+	r.finish(t)
+}
+
+// runner executes testcases against a single testenv.
+type runner[R Reconciler] struct {
+	o             *options
+	envs          *envFactory
+	recorder      *callRecorder
+	newReconciler func(e *Env) R
+	filter        *caseFilter
+	seed          int64
+	shuffle       bool
+	report        *suiteReport
+	output        *serverOutput
+	start         time.Time
+}
+
+func newRunner[R Reconciler](
+	t *testing.T,
+	addToScheme func(*runtime.Scheme) error,
+	env *envtest.Environment,
+	newReconciler func(e *Env) R,
+	focused bool,
+	opts []Option,
+) *runner[R] {
+	t.Helper()
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	seed, shuffle, err := shuffleSeed(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := newCaseFilter(focused)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.leakCheck {
+		// checked after the environment stopped
+		checkGoroutineLeaks(t, o.leakIgnore)
+	}
+	output := captureServerOutput(env)
+	c, audit := startEnv(t, o, addToScheme, env)
+	if env.UseExistingCluster != nil && *env.UseExistingCluster || o.cassetteReplay != "" {
+		output = nil
+	}
+	recorder := &callRecorder{}
+	return &runner[R]{
+		o:             o,
+		envs:          newEnvFactory(t, o, env.Config, c, recorder, audit),
+		recorder:      recorder,
+		newReconciler: newReconciler,
+		filter:        filter,
+		seed:          seed,
+		shuffle:       shuffle,
+		report:        newSuiteReport(t),
+		output:        output,
+		start:         time.Now(),
+	}
+}
 
+// run executes tt within the given groups, outermost first, whose state is created on first use.
+func (r *runner[R]) run(t *testing.T, tt TestCase[R], groups []*Group[R], state *groupState) {
+	t.Helper()
+	var labels []string
+	for _, g := range groups {
+		labels = append(labels, g.Labels...)
+	}
+	labels = append(labels, tt.Labels...)
+	report := r.report.startCase(t, labels)
+	if reason := r.filter.skipReason(labels, tt.Skip, tt.Focus); reason != "" {
+		report.skip(reason)
+		t.Skip(reason)
+	}
+
+	if r.o.leakCheck {
+		// checked after the fixtures were deleted
+		ignore := r.o.leakIgnore
+		if r.o.cachedClient {
+			ignore = append(slices.Clone(ignore), cacheGoroutines...)
+		}
+		checkGoroutineLeaks(t, ignore)
+	}
+	e := r.envs.newEnv(context.Background(), t)
+	report.captureLogs(e.logs)
+	ctx := e.context(context.Background())
+	reconciler := r.newReconciler(e)
+
+	// create state & obj
+	shared := state.create(ctx, t)
+	objs := append([]client.Object(nil), tt.State...)
+	if tt.Obj != nil {
+		objs = append(objs, tt.Obj)
+	}
+	if r.shuffle {
+		objs = shuffleFixtures(objs, r.seed, t.Name())
+		logShuffleOnFailure(t, objs, r.seed)
+	}
+	for _, obj := range objs {
+		r.envs.fixtures.create(ctx, t, obj)
+	}
+	req, err := caseRequest(tt.Obj, tt.Request, e.RunNamespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tt.Delete {
+		deleteObj(ctx, t, r.envs.fixtures.c, tt.Obj)
+	}
+	tl := newTimeline(r.envs.fixtures.c)
+	tl.track(shared...)
+	tl.track(objs...)
+	if r.o.cassetteReplay == "" {
+		callsBefore := len(r.recorder.Calls())
+		touched := func() []string {
+			return touchedNamespaces(e.RunNamespace, tl, r.recorder.Calls()[callsBefore:])
+		}
+		dumpOnFailure(t, r.envs.fixtures.c, r.envs.config, touched, e.logs, r.output)
+	}
+	for _, g := range groups {
+		if g.AfterEach != nil {
+			// deferred to run innermost first, before fixtures are deleted, even if BeforeEach fails
+			defer g.AfterEach(ctx, t, r.envs.fixtures.c)
+		}
+		if g.BeforeEach != nil {
+			g.BeforeEach(ctx, t, r.envs.fixtures.c)
+		}
+	}
+
+	// run the reconciliation, snapshotting the state after every loop
+	tl.snapshot(ctx)
+	e.startAudit()
+	logTimelineOnFailure(t, tl)
+	timeout := r.o.caseTimeout
+	if tt.Timeout > 0 {
+		timeout = tt.Timeout
+	}
+	reconcileCtx, cancel := caseContext(ctx, t, timeout)
+	defer cancel()
+	// a reconciler failing the testcase by hanging keeps recording otherwise
+	defer r.recorder.setEnabled(false)
+	var got ctrl.Result
+	var gotErr error
+	for i := 0; i < max(1, tt.Loops); i++ {
+		before := len(r.recorder.Calls())
+		r.recorder.setEnabled(true)
+		got, gotErr = reconcile(reconcileCtx, t, reconciler, req, r.o.reconcileTimeout)
+		r.recorder.setEnabled(false)
+		tl.trackWrites(r.recorder.Calls()[before:])
+		tl.snapshot(ctx)
+	}
+	e.stopAudit(ctx)
+	report.result(max(1, tt.Loops), got, gotErr, tt.Want, tt.WantErr)
+
+	// assert error, reconcile result and state
+	if !assertResult(t, got, gotErr, tt.Want, tt.WantErr) {
+		return
+	}
+	checkIdempotent := r.o.idempotencyCheck
+	if tt.CheckIdempotency != nil {
+		checkIdempotent = *tt.CheckIdempotency
+	}
+	if checkIdempotent && gotErr == nil && got.IsZero() {
+		checkIdempotency(reconcileCtx, t, reconciler, req, r.recorder, r.o.reconcileTimeout)
+	}
+	if tt.WantSideEffects != nil {
+		tt.WantSideEffects(ctx, e, reconciler)
+	}
+}
+
+// caseRequest returns req if set, or the request for obj.
+// obj has to be created before, so its key is known.
+// req without a namespace targets the one of obj, or runNamespace without obj, like fixtures without a namespace.
+func caseRequest(obj client.Object, req *ctrl.Request, runNamespace string) (ctrl.Request, error) {
+	switch {
+	case req != nil && req.Namespace == "" && obj != nil:
+		return ctrl.Request{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: req.Name}}, nil
+	case req != nil && req.Namespace == "":
+		return ctrl.Request{NamespacedName: types.NamespacedName{Namespace: runNamespace, Name: req.Name}}, nil
+	case req != nil:
+		return *req, nil
+	case obj != nil:
+		return ctrl.Request{NamespacedName: client.ObjectKeyFromObject(obj)}, nil
+	}
+	return ctrl.Request{}, errors.New("testcase sets neither Obj nor Request")
+}
+
+// finish reports on all testcases run.
+func (r *runner[R]) finish(t *testing.T) {
+	r.report.write(t, r.start)
+	if r.o.rbacRolePath != "" {
+		reportRBAC(t, r.o, r.recorder.Calls())
+	}
+}
+
+// startEnv adds the controller scheme, starts env and returns a client for it, and its audit log if requested.
+// The environment is stopped once the test and all its subtests completed.
+func startEnv(
+	t testing.TB,
+	o *options,
+	addToScheme func(*runtime.Scheme) error,
+	env *envtest.Environment,
+) (client.Client, *auditLog) {
+	t.Helper()
 	if err := addToScheme(scheme.Scheme); err != nil {
 		t.Fatalf("init scheme: %s", err)
 	}
 
+	if o.cassetteReplay != "" {
+		if o.auditLog {
+			t.Fatal("init envtest: WithAuditLog can't be combined with WithCassetteReplay")
+		}
+		env.Config = startReplay(t, o.cassetteReplay)
+		c, err := client.New(env.Config, client.Options{})
+		if err != nil {
+			t.Fatalf("init client: %s", err)
+		}
+		return c, nil
+	}
+
+	var audit *auditLog
+	if o.auditLog {
+		if env.UseExistingCluster != nil && *env.UseExistingCluster {
+			t.Fatal("init envtest: WithAuditLog requires a fresh control plane")
+		}
+		audit = configureAuditLog(t, env)
+	}
+	persistent := false
+	if o.persistent || os.Getenv("ENVTEST_PERSISTENT") == "true" {
+		if audit != nil {
+			t.Log("persistent control plane has no audit log, starting a fresh one")
+		} else if err := connectPersistent(env); err != nil {
+			t.Logf("persistent control plane unavailable, starting a fresh one: %s", err)
+		} else {
+			persistent = true
+		}
+	}
+	if err := discoverAssets(env, o.k8sVersion); err != nil {
+		t.Fatalf("init envtest: %s", err)
+	}
 	cfg, err := env.Start()
+	if err != nil && persistent {
+		t.Logf("persistent control plane failed, starting a fresh one: %s", err)
+		env.Config, env.UseExistingCluster = nil, nil
+		if err := discoverAssets(env, o.k8sVersion); err != nil {
+			t.Fatalf("init envtest: %s", err)
+		}
+		cfg, err = env.Start()
+	}
 	if err != nil {
 		t.Fatalf("init envtest: %s", err)
 	}
-	defer func() {
+	o.shared = persistent
+	if audit != nil {
+		o.reconcilerUser = addReconcilerUser(t, env, cfg, audit)
+	}
+	t.Cleanup(func() {
 		if err := env.Stop(); err != nil {
 			t.Fatal("stop testenv:", err)
 		}
-	}()
+	})
+	if o.cassetteRecording != "" {
+		recordCassette(t, cfg, o.cassetteRecording)
+	}
 	c, err := client.New(cfg, client.Options{})
 	if err != nil {
 		t.Fatalf("init client: %s", err)
 	}
-	reconciler := newReconciler(c)
+	return c, audit
+}
 
-	for _, tt := range tests {
-		t.Run(tt.Name, func(t *testing.T) {
-			// create state & obj
-			for _, obj := range tt.State {
-				obj := obj
-				if err := c.Create(ctx, obj); err != nil {
-					t.Fatalf("create obj: %s", err)
-				}
-				defer func() {
-					if err := c.Delete(ctx, obj); err != nil {
-						t.Fatalf("create obj: %s", err)
-					}
-				}()
-			}
-			if err := c.Create(ctx, tt.Obj); err != nil {
-				t.Fatalf("create obj: %s", err)
-			}
-			defer func() {
-				if err := c.Delete(ctx, tt.Obj); err != nil {
-					t.Fatalf("create obj: %s", err)
-				}
-			}()
-
-			// run the reconciliation
-			var got ctrl.Result
-			var gotErr error
-			for i := 0; i < max(1, tt.Loops); i++ {
-				got, gotErr = reconciler.Reconcile(ctx, ctrl.Request{
-					NamespacedName: client.ObjectKeyFromObject(tt.Obj),
-				})
-			}
-
-			// assert error, reconcile result and state
-			if !errors.Is(gotErr, tt.WantErr) {
-				t.Errorf("gotErr: %s\nwant: %s", gotErr, tt.WantErr)
-				return
-			}
-			if diff := cmp.Diff(got, tt.Want); diff != "" {
-				t.Errorf("got: %v\nwant: %v\ndiff: %s", got, tt.Want, diff)
-			}
-			if tt.WantSideEffects != nil {
-				if err := tt.WantSideEffects(ctx, reconciler); err != nil {
-					t.Error("failed sideeffect:", err)
-				}
-			}
-		})
+// fixtureSet creates objects and deletes them again once the test completed.
+// Namespaced objects without a namespace are placed into a namespace unique to the run, which is created on first use.
+// On a shared control plane, fixtures have to live in that namespace, as they would collide with later runs otherwise.
+type fixtureSet struct {
+	t         testing.TB
+	c         client.Client
+	namespace string
+	shared    bool
+}
+
+func newFixtureSet(t testing.TB, c client.Client) *fixtureSet {
+	return &fixtureSet{t: t, c: c}
+}
+
+func (f *fixtureSet) create(ctx context.Context, t testing.TB, obj client.Object) {
+	t.Helper()
+	if err := f.tryCreate(ctx, t, obj); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// tryCreate is like create, but returns errors, e.g. to skip objects rejected by the apiserver.
+// obj is deleted once t completed, if it was created.
+func (f *fixtureSet) tryCreate(ctx context.Context, t testing.TB, obj client.Object) error {
+	t.Helper()
+	applied, isApplied := obj.(*appliedFixture)
+	obj = fixtureObj(obj)
+	if obj.GetNamespace() == "" {
+		namespaced, err := f.c.IsObjectNamespaced(obj)
+		if err != nil {
+			return fmt.Errorf("create obj: %w", err)
+		}
+		if namespaced {
+			obj.SetNamespace(f.runNamespace(ctx, t))
+		}
+	}
+	if f.shared {
+		if err := f.isolated(obj); err != nil {
+			return fmt.Errorf("create obj: %w", err)
+		}
+	}
+	status, err := statusOf(obj)
+	if err != nil {
+		return fmt.Errorf("create obj: %w", err)
+	}
+	if isApplied {
+		err = f.apply(ctx, obj, applied)
+	} else {
+		err = f.c.Create(ctx, obj)
+	}
+	if err != nil {
+		return fmt.Errorf("create obj: %w", err)
+	}
+	t.Cleanup(func() {
+		if err := f.delete(ctx, obj); err != nil {
+			t.Fatalf("delete obj: %s", err)
+		}
+	})
+	if err := f.restoreStatus(ctx, obj, status); err != nil {
+		return fmt.Errorf("create obj status: %w", err)
+	}
+	return nil
+}
+
+func (f *fixtureSet) runNamespace(ctx context.Context, t testing.TB) string {
+	t.Helper()
+	if f.namespace != "" {
+		return f.namespace
+	}
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "envtest-"}}
+	if err := f.c.Create(ctx, ns); err != nil {
+		t.Fatalf("create run namespace: %s", err)
+	}
+	f.namespace = ns.Name
+	f.t.Cleanup(func() {
+		if err := f.c.Delete(ctx, ns); err != nil {
+			f.t.Errorf("delete run namespace: %s", err)
+		}
+	})
+	return f.namespace
+}
+
+// assertResult compares the outcome of the last reconciliation, returns false if the error did not match.
+func assertResult(t testing.TB, got ctrl.Result, gotErr error, want ctrl.Result, wantErr error) bool {
+	t.Helper()
+	errDiff, resultDiff := resultDiffs(got, gotErr, want, wantErr)
+	if errDiff != "" {
+		t.Error(errDiff)
+		return false
+	}
+	if resultDiff != "" {
+		t.Error(resultDiff)
+	}
+	return true
+}
+
+// resultDiffs describes how the outcome of the last reconciliation differs from the desired one.
+// The result is only compared if the error matched.
+func resultDiffs(got ctrl.Result, gotErr error, want ctrl.Result, wantErr error) (errDiff, resultDiff string) {
+	if !errors.Is(gotErr, wantErr) {
+		return fmt.Sprintf("gotErr: %s\nwant: %s", gotErr, wantErr), ""
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		return "", fmt.Sprintf("got: %v\nwant: %v\ndiff: %s", got, want, diff)
 	}
+	return "", ""
 }
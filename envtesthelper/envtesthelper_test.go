@@ -3,9 +3,11 @@ package envtesthelper
 import (
 	"context"
 	"fmt"
+	"os"
 	"testing"
 
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -15,6 +17,10 @@ import (
 )
 
 func Test_RunEnvTest(t *testing.T) {
+	if os.Getenv("ENVTEST_PERSISTENT") == "true" {
+		// namespaces are never gone in envtest, so they can only be created once
+		t.Skip("creates a namespace, see Test_RunEnvTest_persistent")
+	}
 	tests := []TestCase[*mockReconciler]{
 		{
 			Name: "happy",
@@ -31,16 +37,15 @@ func Test_RunEnvTest(t *testing.T) {
 					},
 				},
 			},
-			WantSideEffects: func(ctx context.Context, r *mockReconciler) error {
+			WantSideEffects: func(ctx context.Context, e *Env, r *mockReconciler) {
 				cm := &corev1.ConfigMap{}
 				err := r.Client.Get(ctx, types.NamespacedName{Name: "test-cm", Namespace: "test-namespace"}, cm)
 				if err != nil {
-					return fmt.Errorf("get obj: %w", err)
+					e.T.Fatalf("get obj: %s", err)
 				}
 				if foo, ok := cm.Data["foo"]; !ok || foo != "bar" {
-					return fmt.Errorf("want %q, got %q", "bar", foo)
+					e.T.Errorf("want %q, got %q", "bar", foo)
 				}
-				return nil
 			},
 		},
 	}
@@ -53,13 +58,45 @@ func Test_RunEnvTest(t *testing.T) {
 	)
 }
 
+func Test_RunEnvTest_persistent(t *testing.T) {
+	tests := []TestCase[*mockReconciler]{
+		{
+			Name: "run namespace",
+			Obj: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test-cm",
+				},
+			},
+			WantSideEffects: func(ctx context.Context, e *Env, r *mockReconciler) {
+				cm := &corev1.ConfigMap{}
+				err := e.Client.Get(ctx, types.NamespacedName{Name: "test-cm", Namespace: e.RunNamespace}, cm)
+				if err != nil {
+					e.T.Fatalf("get obj: %s", err)
+				}
+				if foo, ok := cm.Data["foo"]; !ok || foo != "bar" {
+					e.T.Errorf("want %q, got %q", "bar", foo)
+				}
+			},
+		},
+	}
+	// falls back to a fresh control plane if envtestd is not running
+	RunEnvTest(
+		t,
+		corev1.AddToScheme,
+		&envtest.Environment{},
+		NewMockReconciler,
+		tests,
+		WithPersistentControlPlane(),
+	)
+}
+
 type mockReconciler struct {
 	Client client.Client
 }
 
-func NewMockReconciler(client client.Client) *mockReconciler {
+func NewMockReconciler(e *Env) *mockReconciler {
 	return &mockReconciler{
-		Client: client,
+		Client: e.Client,
 	}
 }
 
@@ -79,3 +116,110 @@ func (r *mockReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
   }
 	return ctrl.Result{}, nil
 }
+
+func Test_RunEnvTest_request(t *testing.T) {
+	tests := []TestCase[*ignoreNotFoundReconciler]{
+		{
+			Name:    "absent obj",
+			Request: &ctrl.Request{NamespacedName: types.NamespacedName{Name: "absent", Namespace: "default"}},
+		},
+		{
+			Name: "mapped request",
+			Obj: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "source"},
+			},
+			State: []client.Object{
+				&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "target"},
+				},
+			},
+			Request: &ctrl.Request{NamespacedName: types.NamespacedName{Name: "target"}},
+			WantSideEffects: func(ctx context.Context, e *Env, r *ignoreNotFoundReconciler) {
+				for name, want := range map[string]string{"source": "", "target": "bar"} {
+					cm := &corev1.ConfigMap{}
+					if err := e.Client.Get(ctx, types.NamespacedName{Name: name, Namespace: e.RunNamespace}, cm); err != nil {
+						e.T.Fatalf("get obj: %s", err)
+					}
+					if foo := cm.Data["foo"]; foo != want {
+						e.T.Errorf("%s: want %q, got %q", name, want, foo)
+					}
+				}
+			},
+		},
+	}
+	RunEnvTest(
+		t,
+		corev1.AddToScheme,
+		&envtest.Environment{},
+		func(e *Env) *ignoreNotFoundReconciler {
+			return &ignoreNotFoundReconciler{mockReconciler: NewMockReconciler(e)}
+		},
+		tests,
+	)
+}
+
+// ignoreNotFoundReconciler handles deleted objects like controllers usually do.
+type ignoreNotFoundReconciler struct {
+	*mockReconciler
+}
+
+func (r *ignoreNotFoundReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	if err := r.Client.Get(ctx, req.NamespacedName, &corev1.ConfigMap{}); apierrors.IsNotFound(err) {
+		return ctrl.Result{}, nil
+	}
+	return r.mockReconciler.Reconcile(ctx, req)
+}
+
+func Test_caseRequest(t *testing.T) {
+	obj := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "obj", Namespace: "envtest-abc"}}
+	tests := []struct {
+		name    string
+		obj     client.Object
+		req     *ctrl.Request
+		want    ctrl.Request
+		wantErr bool
+	}{
+		{
+			name: "obj",
+			obj:  obj,
+			want: ctrl.Request{NamespacedName: types.NamespacedName{Name: "obj", Namespace: "envtest-abc"}},
+		},
+		{
+			name: "request",
+			obj:  obj,
+			req:  &ctrl.Request{NamespacedName: types.NamespacedName{Name: "other", Namespace: "default"}},
+			want: ctrl.Request{NamespacedName: types.NamespacedName{Name: "other", Namespace: "default"}},
+		},
+		{
+			name: "request in namespace of obj",
+			obj:  obj,
+			req:  &ctrl.Request{NamespacedName: types.NamespacedName{Name: "other"}},
+			want: ctrl.Request{NamespacedName: types.NamespacedName{Name: "other", Namespace: "envtest-abc"}},
+		},
+		{
+			name: "request without obj",
+			req:  &ctrl.Request{NamespacedName: types.NamespacedName{Name: "other"}},
+			want: ctrl.Request{NamespacedName: types.NamespacedName{Name: "other", Namespace: "envtest-run"}},
+		},
+		{
+			name: "request in namespace without obj",
+			req:  &ctrl.Request{NamespacedName: types.NamespacedName{Name: "other", Namespace: "default"}},
+			want: ctrl.Request{NamespacedName: types.NamespacedName{Name: "other", Namespace: "default"}},
+		},
+		{
+			name:    "neither",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := caseRequest(tt.obj, tt.req, "envtest-run")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("gotErr: %v\nwant: %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got: %v\nwant: %v", got, tt.want)
+			}
+		})
+	}
+}
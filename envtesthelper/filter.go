@@ -0,0 +1,94 @@
+package envtesthelper
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// labelFilter is a disjunction of conjunctions of labels, e.g. "slow&&!flaky,smoke".
+type labelFilter [][]labelTerm
+
+type labelTerm struct {
+	label  string
+	negate bool
+}
+
+// parseLabelFilter parses comma or || separated alternatives of && separated labels, each optionally negated by !.
+// An empty filter matches everything.
+func parseLabelFilter(s string) (labelFilter, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var filter labelFilter
+	for _, alternative := range strings.Split(strings.ReplaceAll(s, "||", ","), ",") {
+		var terms []labelTerm
+		for _, term := range strings.Split(alternative, "&&") {
+			term = strings.TrimSpace(term)
+			label, negate := strings.CutPrefix(term, "!")
+			label = strings.TrimSpace(label)
+			if label == "" {
+				return nil, fmt.Errorf("invalid -envtest.label-filter %q: empty label", s)
+			}
+			terms = append(terms, labelTerm{label: label, negate: negate})
+		}
+		filter = append(filter, terms)
+	}
+	return filter, nil
+}
+
+func (f labelFilter) matches(labels []string) bool {
+	if len(f) == 0 {
+		return true
+	}
+	for _, terms := range f {
+		matched := true
+		for _, term := range terms {
+			if slices.Contains(labels, term.label) == term.negate {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// caseFilter decides which testcases of a table are run.
+type caseFilter struct {
+	labels  labelFilter
+	focused bool
+}
+
+// newCaseFilter returns a filter for a table, focused if any of its testcases sets Focus.
+func newCaseFilter(focused bool) (*caseFilter, error) {
+	labels, err := parseLabelFilter(labelFilterFlag)
+	if err != nil {
+		return nil, err
+	}
+	return &caseFilter{labels: labels, focused: focused}, nil
+}
+
+func anyFocus[R Reconciler](tests []TestCase[R]) bool {
+	for _, tt := range tests {
+		if tt.Focus {
+			return true
+		}
+	}
+	return false
+}
+
+// skipReason returns why a testcase is not run, empty if it is.
+func (f *caseFilter) skipReason(labels []string, skip, focus bool) string {
+	switch {
+	case skip:
+		return "skipped by TestCase.Skip"
+	case f.focused && !focus:
+		return "skipped as other testcases set TestCase.Focus"
+	case !f.labels.matches(labels):
+		return fmt.Sprintf("labels %v do not match -envtest.label-filter=%s", labels, labelFilterFlag)
+	}
+	return ""
+}
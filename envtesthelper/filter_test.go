@@ -0,0 +1,49 @@
+package envtesthelper
+
+import "testing"
+
+func Test_labelFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		labels []string
+		want   bool
+	}{
+		{filter: "", labels: nil, want: true},
+		{filter: "slow", labels: []string{"slow"}, want: true},
+		{filter: "slow", labels: []string{"fast"}, want: false},
+		{filter: "!slow", labels: nil, want: true},
+		{filter: "!slow", labels: []string{"slow"}, want: false},
+		{filter: "slow,smoke", labels: []string{"smoke"}, want: true},
+		{filter: "slow || smoke", labels: []string{"smoke"}, want: true},
+		{filter: "slow&&!flaky", labels: []string{"slow", "flaky"}, want: false},
+		{filter: "slow && !flaky", labels: []string{"slow"}, want: true},
+	}
+	for _, tt := range tests {
+		f, err := parseLabelFilter(tt.filter)
+		if err != nil {
+			t.Fatalf("parse %q: %s", tt.filter, err)
+		}
+		if got := f.matches(tt.labels); got != tt.want {
+			t.Errorf("%q matches %v: got %t, want %t", tt.filter, tt.labels, got, tt.want)
+		}
+	}
+
+	for _, invalid := range []string{"slow,", "!", "slow&&"} {
+		if _, err := parseLabelFilter(invalid); err == nil {
+			t.Errorf("parse %q: want error", invalid)
+		}
+	}
+}
+
+func Test_caseFilter(t *testing.T) {
+	f := &caseFilter{focused: true}
+	if reason := f.skipReason(nil, false, true); reason != "" {
+		t.Errorf("focused testcase skipped: %s", reason)
+	}
+	if reason := f.skipReason(nil, false, false); reason == "" {
+		t.Error("unfocused testcase not skipped")
+	}
+	if reason := f.skipReason(nil, true, true); reason == "" {
+		t.Error("testcase with Skip not skipped")
+	}
+}
@@ -0,0 +1,87 @@
+package envtesthelper
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// BlockingFinalizer simulates another controller blocking the deletion of an object.
+// Fixtures keep it until the testcase completed.
+const BlockingFinalizer = "envtesthelper.gfelbing.github.com/blocking"
+
+// WithFinalizers adds finalizers to obj and returns it, e.g. to create a fixture with
+// WithFinalizers(obj, "my.domain/cleanup", BlockingFinalizer).
+func WithFinalizers[O client.Object](obj O, finalizers ...string) O {
+	for _, finalizer := range finalizers {
+		if !slices.Contains(obj.GetFinalizers(), finalizer) {
+			obj.SetFinalizers(append(obj.GetFinalizers(), finalizer))
+		}
+	}
+	return obj
+}
+
+// deleteObj deletes obj, which has to stay in deletion because of its finalizers.
+func deleteObj(ctx context.Context, t testing.TB, c client.Client, obj client.Object) {
+	t.Helper()
+	if obj == nil {
+		t.Fatal("delete obj: testcase sets Delete without Obj")
+	}
+	obj = fixtureObj(obj)
+	if len(obj.GetFinalizers()) == 0 {
+		t.Fatalf("delete obj: %s has no finalizers and would be gone right away", client.ObjectKeyFromObject(obj))
+	}
+	if err := c.Delete(ctx, obj); err != nil {
+		t.Fatalf("delete obj: %s", err)
+	}
+}
+
+// delete removes obj including all its finalizers, ignoring it if it is already gone.
+func (f *fixtureSet) delete(ctx context.Context, obj client.Object) error {
+	current := obj.DeepCopyObject().(client.Object)
+	if err := f.c.Get(ctx, client.ObjectKeyFromObject(obj), current); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if len(current.GetFinalizers()) > 0 {
+		patch := client.MergeFrom(current.DeepCopyObject().(client.Object))
+		current.SetFinalizers(nil)
+		if err := f.c.Patch(ctx, current, patch); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+	}
+	return client.IgnoreNotFound(f.c.Delete(ctx, current))
+}
+
+// WantGone asserts obj does not exist anymore, reading from the apiserver directly.
+func (e *Env) WantGone(ctx context.Context, obj client.Object) {
+	e.T.Helper()
+	current := obj.DeepCopyObject().(client.Object)
+	err := e.harness.Get(ctx, client.ObjectKeyFromObject(obj), current)
+	switch {
+	case apierrors.IsNotFound(err):
+	case err != nil:
+		e.T.Errorf("get obj: %s", err)
+	default:
+		e.T.Errorf("%s still exists with finalizers %v", client.ObjectKeyFromObject(obj), current.GetFinalizers())
+	}
+}
+
+// WantFinalizers asserts obj exists with exactly the given finalizers, in any order, reading from the apiserver directly.
+func (e *Env) WantFinalizers(ctx context.Context, obj client.Object, want ...string) {
+	e.T.Helper()
+	current := obj.DeepCopyObject().(client.Object)
+	if err := e.harness.Get(ctx, client.ObjectKeyFromObject(obj), current); err != nil {
+		e.T.Errorf("get obj: %s", err)
+		return
+	}
+	got := slices.Clone(current.GetFinalizers())
+	slices.Sort(got)
+	want = slices.Clone(want)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		e.T.Errorf("%s: got finalizers %v, want %v", client.ObjectKeyFromObject(obj), got, want)
+	}
+}
@@ -0,0 +1,125 @@
+package envtesthelper
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+const cleanupFinalizer = "envtesthelper.gfelbing.github.com/cleanup"
+
+func Test_RunEnvTest_deletion(t *testing.T) {
+	tests := []TestCase[*finalizerReconciler]{
+		{
+			Name:   "cleanup",
+			Obj:    WithFinalizers(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "deleted"}}, cleanupFinalizer),
+			Delete: true,
+			WantSideEffects: func(ctx context.Context, e *Env, r *finalizerReconciler) {
+				if r.cleanedUp != 1 {
+					e.T.Errorf("cleaned up %d times, want once", r.cleanedUp)
+				}
+				e.WantGone(ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "deleted", Namespace: e.RunNamespace}})
+			},
+		},
+		{
+			Name: "blocked by another finalizer",
+			Obj: WithFinalizers(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "blocked"}},
+				cleanupFinalizer, BlockingFinalizer),
+			Delete: true,
+			WantSideEffects: func(ctx context.Context, e *Env, r *finalizerReconciler) {
+				e.WantFinalizers(ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "blocked", Namespace: e.RunNamespace}},
+					BlockingFinalizer)
+			},
+		},
+	}
+	RunEnvTest(
+		t,
+		corev1.AddToScheme,
+		&envtest.Environment{},
+		func(e *Env) *finalizerReconciler { return &finalizerReconciler{Client: e.Client} },
+		tests,
+	)
+}
+
+// finalizerReconciler cleans up before letting ConfigMaps go.
+type finalizerReconciler struct {
+	Client    client.Client
+	cleanedUp int
+}
+
+func (r *finalizerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	cm := &corev1.ConfigMap{}
+	if err := r.Client.Get(ctx, req.NamespacedName, cm); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if cm.DeletionTimestamp.IsZero() || !controllerutil.ContainsFinalizer(cm, cleanupFinalizer) {
+		return ctrl.Result{}, nil
+	}
+	r.cleanedUp++
+	controllerutil.RemoveFinalizer(cm, cleanupFinalizer)
+	if err := r.Client.Update(ctx, cm); err != nil {
+		return ctrl.Result{}, fmt.Errorf("remove finalizer: %w", err)
+	}
+	return ctrl.Result{}, nil
+}
+
+func Test_fixtureSet_delete(t *testing.T) {
+	ctx := context.Background()
+	c := fake.NewClientBuilder().Build()
+	f := newFixtureSet(t, c)
+	cm := WithFinalizers(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default"}}, BlockingFinalizer)
+	if err := c.Create(ctx, cm); err != nil {
+		t.Fatalf("create obj: %s", err)
+	}
+	if err := c.Delete(ctx, cm); err != nil {
+		t.Fatalf("delete obj: %s", err)
+	}
+
+	if err := f.delete(ctx, cm); err != nil {
+		t.Fatalf("delete fixture: %s", err)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(cm), &corev1.ConfigMap{}); !apierrors.IsNotFound(err) {
+		t.Errorf("got %v, want fixture to be gone", err)
+	}
+	if err := f.delete(ctx, cm); err != nil {
+		t.Errorf("delete absent fixture: %s", err)
+	}
+}
+
+func Test_deleteObj_withoutObj(t *testing.T) {
+	tb := &fatalCapturingTB{errorCapturingTB: errorCapturingTB{TB: t}}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		deleteObj(context.Background(), tb, fake.NewClientBuilder().Build(), nil)
+	}()
+	<-done
+	if !strings.Contains(tb.fatal, "without Obj") {
+		t.Errorf("got fatal %q, want Delete without Obj reported", tb.fatal)
+	}
+}
+
+func Test_Env_WantFinalizers_harness(t *testing.T) {
+	ctx := context.Background()
+	cm := WithFinalizers(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default"}}, BlockingFinalizer)
+	harness := fake.NewClientBuilder().WithObjects(cm.DeepCopy()).Build()
+	// a stale cache of the reconciler, which did not see the obj yet
+	stale := fake.NewClientBuilder().Build()
+	tb := &errorCapturingTB{TB: t}
+	e := &Env{T: tb, Client: stale, harness: harness}
+
+	e.WantFinalizers(ctx, cm, BlockingFinalizer)
+	if len(tb.errors) > 0 {
+		t.Errorf("got errors %v, want obj read from the apiserver", tb.errors)
+	}
+}
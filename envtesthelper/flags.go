@@ -0,0 +1,36 @@
+package envtesthelper
+
+import (
+	"flag"
+	"testing"
+)
+
+// test flags, e.g. go test ./... -args -envtest.shuffle=on
+var (
+	shuffleFlag      = "off"
+	labelFilterFlag  string
+	junitReportFlag  string
+	jsonReportFlag   string
+	artifactsDirFlag string
+)
+
+// init registers the test flags in test binaries only, so commands importing envtesthelper, like envtestd, don't get them.
+func init() {
+	if !testing.Testing() {
+		return
+	}
+	registerFlags(flag.CommandLine)
+}
+
+func registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&shuffleFlag, "envtest.shuffle", shuffleFlag,
+		"Randomize the creation order of fixtures: off, on, or the seed of a permutation to rerun.")
+	fs.StringVar(&labelFilterFlag, "envtest.label-filter", labelFilterFlag,
+		"Only run testcases with matching labels, e.g. slow&&!flaky,smoke runs slow testcases not flaky and smoke testcases.")
+	fs.StringVar(&junitReportFlag, "envtest.junit-report", junitReportFlag,
+		"Write a JUnit XML report of all testcases to this path, defaults to $ENVTEST_JUNIT_REPORT.")
+	fs.StringVar(&jsonReportFlag, "envtest.json-report", jsonReportFlag,
+		"Write a JSON report of all testcases to this path, defaults to $ENVTEST_JSON_REPORT.")
+	fs.StringVar(&artifactsDirFlag, "envtest.artifacts-dir", artifactsDirFlag,
+		"Write artifacts of failed testcases to this directory, defaults to $ARTIFACTS or a temporary directory per failed testcase.")
+}
@@ -0,0 +1,22 @@
+package envtesthelper
+
+import (
+	"flag"
+	"testing"
+)
+
+func Test_registerFlags(t *testing.T) {
+	if flag.Lookup("envtest.shuffle") == nil {
+		t.Errorf("test flags are not registered in test binaries")
+	}
+
+	defer func(shuffle string) { shuffleFlag = shuffle }(shuffleFlag)
+	fs := flag.NewFlagSet("envtestd", flag.ContinueOnError)
+	registerFlags(fs)
+	if err := fs.Parse([]string{"-envtest.shuffle=42"}); err != nil {
+		t.Fatal(err)
+	}
+	if shuffleFlag != "42" {
+		t.Errorf("got shuffle %q, want 42", shuffleFlag)
+	}
+}
@@ -0,0 +1,124 @@
+package envtesthelper
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	fuzz "github.com/google/gofuzz"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// Invariant must hold after every fuzzed reconciliation of obj.
+type Invariant[R Reconciler] func(ctx context.Context, r R, obj client.Object, got ctrl.Result, gotErr error) error
+
+// WrappedErrors requires every returned error to wrap another one, so callers can inspect it with errors.Is.
+// Errors wrapping several ones, like errors.Join, have to wrap at least one.
+func WrappedErrors[R Reconciler]() Invariant[R] {
+	return func(_ context.Context, _ R, _ client.Object, _ ctrl.Result, gotErr error) error {
+		if gotErr != nil && !wrapsError(gotErr) {
+			return fmt.Errorf("unwrapped error: %w", gotErr)
+		}
+		return nil
+	}
+}
+
+// wrapsError reports whether err wraps another error, by Unwrap() error or Unwrap() []error.
+func wrapsError(err error) bool {
+	switch err := err.(type) {
+	case interface{ Unwrap() error }:
+		return err.Unwrap() != nil
+	case interface{ Unwrap() []error }:
+		return slices.ContainsFunc(err.Unwrap(), func(e error) bool { return e != nil })
+	}
+	return false
+}
+
+// FuzzReconcile bootstraps a testenv and reconciles objects generated from fuzzed input, checking all invariants
+// afterwards. A panicking reconciler always fails, reconciliations are limited by WithTimeout and WithReconcileTimeout.
+// newReconciler is called once per input.
+// generate should derive the object from fz, e.g. by fz.Fuzz(&obj.Spec); objects without a name get one generated,
+// objects rejected as invalid by the apiserver are skipped.
+// Failing inputs are minimized and stored in testdata/fuzz by go test, so they are rerun as regular tests.
+func FuzzReconcile[R Reconciler](
+	f *testing.F,
+	addToScheme func(*runtime.Scheme) error,
+	env *envtest.Environment,
+	newReconciler func(e *Env) R,
+	generate func(fz *fuzz.Fuzzer) client.Object,
+	invariants []Invariant[R],
+	opts ...Option,
+) {
+	f.Helper()
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	c, audit := startEnv(f, o, addToScheme, env)
+	recorder := &callRecorder{}
+	envs := newEnvFactory(f, o, env.Config, c, recorder, audit)
+	// the run namespace has to exist before fuzzing, as f must not be used within the fuzz target
+	envs.fixtures.runNamespace(context.Background(), f)
+	if o.rbacRolePath != "" {
+		f.Cleanup(func() {
+			reportRBAC(f, o, recorder.Calls())
+		})
+	}
+
+	f.Add([]byte(nil))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		e := envs.newEnv(context.Background(), t)
+		ctx := e.context(context.Background())
+		reconciler := newReconciler(e)
+		obj := generate(fuzz.NewFromGoFuzz(data))
+		if obj.GetName() == "" && obj.GetGenerateName() == "" {
+			obj.SetGenerateName("fuzz-")
+		}
+		if err := envs.fixtures.tryCreate(ctx, t, obj); err != nil {
+			if apierrors.IsInvalid(err) {
+				t.Skip("invalid obj:", err)
+			}
+			t.Fatal(err)
+		}
+		obj = fixtureObj(obj)
+
+		reconcileCtx, cancel := caseContext(ctx, t, o.caseTimeout)
+		defer cancel()
+		// a reconciler failing the input by hanging keeps recording otherwise
+		defer recorder.setEnabled(false)
+		e.startAudit()
+		recorder.setEnabled(true)
+		got, gotErr := reconcileRecovered(reconcileCtx, t, reconciler, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(obj)},
+			o.reconcileTimeout)
+		recorder.setEnabled(false)
+		e.stopAudit(ctx)
+		for _, invariant := range invariants {
+			if err := invariant(ctx, reconciler, obj, got, gotErr); err != nil {
+				t.Errorf("invariant violated for %v: %s", obj, err)
+			}
+		}
+	})
+}
+
+// reconcileRecovered is like reconcile, but fails the test with the stack of a panicking reconciler.
+func reconcileRecovered(
+	ctx context.Context,
+	t testing.TB,
+	r Reconciler,
+	req ctrl.Request,
+	timeout time.Duration,
+) (ctrl.Result, error) {
+	t.Helper()
+	defer func() {
+		if p := recover(); p != nil {
+			t.Fatalf("reconcile panicked: %v", p)
+		}
+	}()
+	return reconcile(ctx, t, r, req, timeout)
+}
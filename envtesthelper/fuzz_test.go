@@ -0,0 +1,109 @@
+package envtesthelper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	fuzz "github.com/google/gofuzz"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+func Fuzz_Reconcile(f *testing.F) {
+	FuzzReconcile(
+		f,
+		corev1.AddToScheme,
+		&envtest.Environment{},
+		NewMockReconciler,
+		func(fz *fuzz.Fuzzer) client.Object {
+			cm := &corev1.ConfigMap{}
+			fz.Fuzz(&cm.Data)
+			return cm
+		},
+		[]Invariant[*mockReconciler]{
+			WrappedErrors[*mockReconciler](),
+			func(ctx context.Context, r *mockReconciler, obj client.Object, got ctrl.Result, gotErr error) error {
+				if gotErr != nil {
+					return nil
+				}
+				cm := &corev1.ConfigMap{}
+				if err := r.Client.Get(ctx, client.ObjectKeyFromObject(obj), cm); err != nil {
+					return fmt.Errorf("get obj: %w", err)
+				}
+				if foo := cm.Data["foo"]; foo != "bar" {
+					return fmt.Errorf("want %q, got %q", "bar", foo)
+				}
+				return nil
+			},
+		},
+	)
+}
+
+func Test_WrappedErrors(t *testing.T) {
+	base := errors.New("boom")
+	tests := []struct {
+		name    string
+		err     error
+		wantErr bool
+	}{
+		{name: "no error"},
+		{name: "unwrapped", err: base, wantErr: true},
+		{name: "wrapped", err: fmt.Errorf("get obj: %w", base)},
+		{name: "joined", err: errors.Join(base, errors.New("bang"))},
+		{name: "wrapping several", err: fmt.Errorf("get obj: %w, %w", base, errors.New("bang"))},
+		{name: "formatted without wrapping", err: fmt.Errorf("get obj: %v", base), wantErr: true},
+	}
+	invariant := WrappedErrors[*mockReconciler]()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := invariant(context.Background(), nil, nil, ctrl.Result{}, tt.err)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_reconcileRecovered(t *testing.T) {
+	tests := []struct {
+		name      string
+		r         Reconciler
+		wantErr   error
+		wantFatal string
+	}{
+		{
+			name:      "panic",
+			r:         panicReconciler{},
+			wantFatal: "reconcile panicked: boom",
+		},
+		{
+			name:    "timeout",
+			r:       &sleepReconciler{},
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := &fatalCapturingTB{errorCapturingTB: errorCapturingTB{TB: t}}
+			var gotErr error
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				_, gotErr = reconcileRecovered(context.Background(), tb, tt.r, ctrl.Request{}, 10*time.Millisecond)
+			}()
+			<-done
+			if !errors.Is(gotErr, tt.wantErr) {
+				t.Errorf("got error %v, want %v", gotErr, tt.wantErr)
+			}
+			if !strings.HasPrefix(tb.fatal, tt.wantFatal) || (tt.wantFatal == "") != (tb.fatal == "") {
+				t.Errorf("got fatal %q, want %q", tb.fatal, tt.wantFatal)
+			}
+		})
+	}
+}
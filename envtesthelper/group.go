@@ -0,0 +1,126 @@
+package envtesthelper
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// Group shares state and hooks among its testcases and subgroups, which run as nested subtests.
+type Group[R Reconciler] struct {
+	// Name of the group
+	Name string
+	// State shared by the testcases of the group and its subgroups. Created before the first testcase which runs,
+	// after the State of parent groups, and deleted once the group completed.
+	// Testcases see the changes previous ones made to it.
+	State []client.Object
+	// Labels added to every testcase of the group and its subgroups
+	Labels []string
+	// BeforeEach runs before every testcase of the group and its subgroups once its state was created, outermost first
+	BeforeEach func(ctx context.Context, t testing.TB, c client.Client)
+	// AfterEach runs after every testcase of the group and its subgroups before its state is deleted, innermost first
+	AfterEach func(ctx context.Context, t testing.TB, c client.Client)
+	// Cases of the group
+	Cases []TestCase[R]
+	// Groups nested in the group, run after Cases
+	Groups []Group[R]
+}
+
+// RunEnvTestGroups bootstraps a testenv and executes the testcases of all given groups, named <group>/<subgroup>/<testcase>.
+func RunEnvTestGroups[R Reconciler](
+	t *testing.T,
+	addToScheme func(*runtime.Scheme) error,
+	env *envtest.Environment,
+	newReconciler func(e *Env) R,
+	groups []Group[R],
+	opts ...Option,
+) {
+	t.Helper()
+	focused := false
+	for _, g := range groups {
+		focused = focused || g.focused()
+	}
+	r := newRunner(t, addToScheme, env, newReconciler, focused, opts)
+	for i := range groups {
+		r.runGroup(t, &groups[i], nil, nil)
+	}
+	r.finish(t)
+}
+
+func (r *runner[R]) runGroup(t *testing.T, g *Group[R], parents []*Group[R], parentState *groupState) {
+	t.Run(g.Name, func(t *testing.T) {
+		groups := append(append([]*Group[R](nil), parents...), g)
+		state := &groupState{
+			parent:   parentState,
+			t:        t,
+			fixtures: r.envs.fixtures,
+			objs:     copyFixtures(g.State),
+		}
+		for _, tt := range g.Cases {
+			t.Run(tt.Name, func(t *testing.T) {
+				r.run(t, tt, groups, state)
+			})
+		}
+		for i := range g.Groups {
+			r.runGroup(t, &g.Groups[i], groups, state)
+		}
+	})
+}
+
+// groupState creates the State of a group once, when the first of its testcases runs,
+// so e.g. Namespaces are not recreated while envtest still terminates them.
+type groupState struct {
+	parent *groupState
+	// t of the group, which deletes the state once completed
+	t        testing.TB
+	fixtures *fixtureSet
+	objs     []client.Object
+	created  bool
+}
+
+// create creates the state of the group and its parents within the testcase t, if not done yet,
+// and returns all of it, outermost first.
+func (s *groupState) create(ctx context.Context, t testing.TB) []client.Object {
+	t.Helper()
+	if s == nil {
+		return nil
+	}
+	objs := s.parent.create(ctx, t)
+	if !s.created {
+		s.created = true
+		for _, obj := range s.objs {
+			s.fixtures.create(ctx, seedTB{TB: t, parent: s.t}, obj)
+		}
+	}
+	return append(objs, s.objs...)
+}
+
+// focused reports whether any testcase of g or its subgroups sets Focus.
+func (g *Group[R]) focused() bool {
+	if anyFocus(g.Cases) {
+		return true
+	}
+	for i := range g.Groups {
+		if g.Groups[i].focused() {
+			return true
+		}
+	}
+	return false
+}
+
+// copyFixtures deep copies shared fixtures, so the given ones are left untouched when creating them.
+func copyFixtures(objs []client.Object) []client.Object {
+	copies := make([]client.Object, len(objs))
+	for i, obj := range objs {
+		c := obj.DeepCopyObject().(client.Object)
+		c.SetResourceVersion("")
+		c.SetUID("")
+		c.SetCreationTimestamp(metav1.Time{})
+		copies[i] = c
+	}
+	return copies
+}
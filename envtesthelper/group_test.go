@@ -0,0 +1,174 @@
+package envtesthelper
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+func Test_RunEnvTestGroups(t *testing.T) {
+	var hooks []string
+	wantFoo := func(ctx context.Context, e *Env, r *mockReconciler) {
+		cm := &corev1.ConfigMap{}
+		if err := e.Client.Get(ctx, client.ObjectKey{Name: "test-cm", Namespace: e.RunNamespace}, cm); err != nil {
+			e.T.Fatalf("get obj: %s", err)
+		}
+		if foo := cm.Data["foo"]; foo != "bar" {
+			e.T.Errorf("want %q, got %q", "bar", foo)
+		}
+	}
+	var sharedUIDs []types.UID
+	wantShared := func(ctx context.Context, e *Env, r *mockReconciler) {
+		wantFoo(ctx, e, r)
+		secret := &corev1.Secret{}
+		if err := e.Client.Get(ctx, client.ObjectKey{Name: "shared", Namespace: e.RunNamespace}, secret); err != nil {
+			e.T.Fatalf("get shared: %s", err)
+		}
+		sharedUIDs = append(sharedUIDs, secret.UID)
+	}
+	groups := []Group[*mockReconciler]{
+		{
+			Name: "shared secret",
+			State: []client.Object{
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "shared"}},
+			},
+			BeforeEach: func(ctx context.Context, t testing.TB, c client.Client) {
+				hooks = append(hooks, "before outer")
+			},
+			AfterEach: func(ctx context.Context, t testing.TB, c client.Client) {
+				hooks = append(hooks, "after outer")
+			},
+			Cases: []TestCase[*mockReconciler]{
+				{
+					Name:            "first",
+					Obj:             &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "test-cm"}},
+					WantSideEffects: wantShared,
+				},
+			},
+			Groups: []Group[*mockReconciler]{
+				{
+					Name: "nested",
+					BeforeEach: func(ctx context.Context, t testing.TB, c client.Client) {
+						secrets := &corev1.SecretList{}
+						if err := c.List(ctx, secrets); err != nil {
+							t.Fatalf("list secrets: %s", err)
+						}
+						if !slices.ContainsFunc(secrets.Items, func(s corev1.Secret) bool { return s.Name == "shared" }) {
+							t.Fatal("inherited state missing")
+						}
+						hooks = append(hooks, "before inner")
+					},
+					AfterEach: func(ctx context.Context, t testing.TB, c client.Client) {
+						hooks = append(hooks, "after inner")
+					},
+					Cases: []TestCase[*mockReconciler]{
+						{
+							Name:            "second",
+							Obj:             &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "test-cm"}},
+							WantSideEffects: wantShared,
+						},
+					},
+				},
+			},
+		},
+	}
+	// namespaces are never gone in envtest, so they can only be created once
+	persistent := os.Getenv("ENVTEST_PERSISTENT") == "true"
+	inNamespace := func(ctx context.Context, e *Env, r *mockReconciler) {
+		cm := &corev1.ConfigMap{}
+		if err := e.Client.Get(ctx, client.ObjectKey{Name: "test-cm", Namespace: "test-group"}, cm); err != nil {
+			e.T.Fatalf("get obj: %s", err)
+		}
+	}
+	groups = append(groups, Group[*mockReconciler]{
+		Name: "shared namespace",
+		State: []client.Object{
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "test-group"}},
+		},
+		Cases: []TestCase[*mockReconciler]{
+			{
+				Name:            "first",
+				Obj:             &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "test-cm", Namespace: "test-group"}},
+				WantSideEffects: inNamespace,
+				Skip:            persistent,
+			},
+			{
+				Name:            "second",
+				Obj:             &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "test-cm", Namespace: "test-group"}},
+				WantSideEffects: inNamespace,
+				Skip:            persistent,
+			},
+		},
+	})
+	RunEnvTestGroups(
+		t,
+		corev1.AddToScheme,
+		&envtest.Environment{},
+		NewMockReconciler,
+		groups,
+	)
+
+	want := []string{"before outer", "after outer", "before outer", "before inner", "after inner", "after outer"}
+	if fmt.Sprint(hooks) != fmt.Sprint(want) {
+		t.Errorf("got hooks: %v\nwant: %v", hooks, want)
+	}
+	if len(sharedUIDs) != 2 || sharedUIDs[0] != sharedUIDs[1] {
+		t.Errorf("got shared secrets %v, want the same one in both testcases", sharedUIDs)
+	}
+}
+
+func Test_groupState_create(t *testing.T) {
+	ctx := context.Background()
+	c := fake.NewClientBuilder().Build()
+	fixtures := newFixtureSet(t, c)
+	outer := &groupState{
+		t:        t,
+		fixtures: fixtures,
+		objs:     []client.Object{&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "outer", Namespace: "default"}}},
+	}
+	inner := &groupState{
+		parent:   outer,
+		t:        t,
+		fixtures: fixtures,
+		objs:     []client.Object{&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "inner", Namespace: "default"}}},
+	}
+
+	var got []string
+	for i := 0; i < 2; i++ {
+		// would fail with AlreadyExists if created again
+		got = got[:0]
+		for _, obj := range inner.create(ctx, t) {
+			got = append(got, obj.GetName())
+		}
+	}
+	if fmt.Sprint(got) != fmt.Sprint([]string{"outer", "inner"}) {
+		t.Errorf("got state: %v\nwant: [outer inner]", got)
+	}
+	var nilState *groupState
+	if got := nilState.create(ctx, t); got != nil {
+		t.Errorf("got state %v without group, want none", got)
+	}
+}
+
+func Test_copyFixtures(t *testing.T) {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns", ResourceVersion: "1", UID: "uid"}}
+	got := copyFixtures([]client.Object{ns})[0]
+	if got == client.Object(ns) {
+		t.Fatal("fixture not copied")
+	}
+	if got.GetName() != "ns" || got.GetResourceVersion() != "" || got.GetUID() != "" {
+		t.Errorf("got: %v\nwant: name kept, resourceVersion and uid cleared", got)
+	}
+	if ns.ResourceVersion != "1" {
+		t.Error("original fixture modified")
+	}
+}
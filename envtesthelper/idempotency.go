@@ -0,0 +1,52 @@
+package envtesthelper
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// WithIdempotencyCheck enables TestCase.CheckIdempotency for all testcases which do not set it.
+func WithIdempotencyCheck() Option {
+	return func(o *options) {
+		o.idempotencyCheck = true
+	}
+}
+
+// checkIdempotency reconciles req once more and fails if that wrote to the cluster.
+func checkIdempotency(ctx context.Context, t testing.TB, r Reconciler, req ctrl.Request, recorder *callRecorder, timeout time.Duration) {
+	t.Helper()
+	before := len(recorder.Calls())
+	recorder.setDiffs(true)
+	recorder.setEnabled(true)
+	_, err := reconcile(ctx, t, r, req, timeout)
+	recorder.setEnabled(false)
+	recorder.setDiffs(false)
+	if err != nil {
+		t.Errorf("reconcile is not idempotent, one more reconciliation failed: %s", err)
+		return
+	}
+
+	var writes []string
+	for _, call := range recorder.Calls()[before:] {
+		if !call.IsWrite() {
+			continue
+		}
+		resource := call.Resource.Resource
+		if call.Subresource != "" {
+			resource += "/" + call.Subresource
+		}
+		write := fmt.Sprintf("%s %s %s/%s", call.Verb, resource, call.Namespace, call.Name)
+		if call.Diff != "" {
+			write += "\n" + call.Diff
+		}
+		writes = append(writes, write)
+	}
+	if len(writes) > 0 {
+		t.Errorf("reconcile is not idempotent, one more reconciliation wrote:\n%s", strings.Join(writes, "\n"))
+	}
+}
@@ -0,0 +1,141 @@
+package envtesthelper
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+func Test_recordingClient_diffs(t *testing.T) {
+	ctx := context.Background()
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default"}}
+	recorder := &callRecorder{}
+	fc := fake.NewClientBuilder().WithObjects(cm).Build()
+	c := newRecordingClient(fc, fc, recorder)
+	r := &timestampReconciler{Client: c}
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(cm)}
+
+	recorder.setDiffs(true)
+	recorder.setEnabled(true)
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("reconcile: %s", err)
+	}
+	recorder.setEnabled(false)
+
+	calls := recorder.Calls()
+	if len(calls) != 2 || calls[1].Verb != "update" {
+		t.Fatalf("got: %v\nwant: get, update", calls)
+	}
+	if !strings.Contains(calls[1].Diff, "reconciled-at") {
+		t.Errorf("got: %s\nwant: diff of reconciled-at", calls[1].Diff)
+	}
+}
+
+// timestampReconciler is not idempotent, it stamps the time of every reconciliation.
+type timestampReconciler struct {
+	Client client.Client
+}
+
+func (r *timestampReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	cm := &corev1.ConfigMap{}
+	if err := r.Client.Get(ctx, req.NamespacedName, cm); err != nil {
+		return ctrl.Result{}, err
+	}
+	cm.Annotations = map[string]string{"reconciled-at": time.Now().Format(time.RFC3339Nano)}
+	return ctrl.Result{}, r.Client.Update(ctx, cm)
+}
+
+func Test_recordingClient_diffsFromHarness(t *testing.T) {
+	ctx := context.Background()
+	stale := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default"}}
+	current := stale.DeepCopy()
+	current.Data = map[string]string{"foo": "bar"}
+	recorder := &callRecorder{}
+	// the reconciler's client lags behind, like a cached one
+	c := newRecordingClient(
+		fake.NewClientBuilder().WithObjects(stale).Build(),
+		fake.NewClientBuilder().WithObjects(current).Build(),
+		recorder,
+	)
+
+	recorder.setDiffs(true)
+	recorder.setEnabled(true)
+	updated := stale.DeepCopy()
+	updated.Data = map[string]string{"foo": "bar"}
+	if err := c.Update(ctx, updated); err != nil {
+		t.Fatalf("update: %s", err)
+	}
+	recorder.setEnabled(false)
+
+	calls := recorder.Calls()
+	if len(calls) != 1 || calls[0].Diff != "" {
+		t.Errorf("got: %+v\nwant: update without diff to the current state", calls)
+	}
+}
+
+func Test_checkIdempotency(t *testing.T) {
+	tests := []struct {
+		name       string
+		reconciler func(c client.Client) Reconciler
+		wantErrors []string
+	}{
+		{
+			name:       "idempotent",
+			reconciler: func(c client.Client) Reconciler { return &mockReconciler{Client: c} },
+		},
+		{
+			name:       "stamps every reconciliation",
+			reconciler: func(c client.Client) Reconciler { return &timestampReconciler{Client: c} },
+			wantErrors: []string{"reconcile is not idempotent, one more reconciliation wrote:\n%s"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cm := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default"},
+				Data:       map[string]string{"foo": "bar"},
+			}
+			fc := fake.NewClientBuilder().WithObjects(cm).Build()
+			recorder := &callRecorder{}
+			r := tt.reconciler(newRecordingClient(fc, fc, recorder))
+			req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(cm)}
+			if _, err := r.Reconcile(ctx, req); err != nil {
+				t.Fatalf("reconcile: %s", err)
+			}
+
+			tb := &errorCapturingTB{TB: t}
+			checkIdempotency(ctx, tb, r, req, recorder, 0)
+			if diff := cmp.Diff(tb.errors, tt.wantErrors); diff != "" {
+				t.Errorf("got errors %v\ndiff: %s", tb.errors, diff)
+			}
+		})
+	}
+}
+
+func Test_RunEnvTest_idempotency(t *testing.T) {
+	tests := []TestCase[*mockReconciler]{
+		{
+			Name:             "idempotent",
+			Obj:              &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "test-cm"}},
+			CheckIdempotency: ptr.To(true),
+		},
+	}
+	RunEnvTest(
+		t,
+		corev1.AddToScheme,
+		&envtest.Environment{},
+		NewMockReconciler,
+		tests,
+	)
+}
@@ -0,0 +1,94 @@
+package envtesthelper
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// leakGrace is how long goroutines may take to stop once a testcase or the environment was cleaned up.
+var leakGrace = 5 * time.Second
+
+// ignoredGoroutines are known background routines of envtest, client-go and the standard library.
+// Goroutines with any of them in their stack are never reported as leaked.
+var ignoredGoroutines = []string{
+	"k8s.io/klog/v2.(*flushDaemon).run",
+	"net/http.(*persistConn).readLoop",
+	"net/http.(*persistConn).writeLoop",
+	"net/http.(*http2ClientConn).readLoop",
+	"golang.org/x/net/http2.(*ClientConn).readLoop",
+	"k8s.io/client-go/transport.(*dynamicClientCert).Run",
+	"os/signal.signal_recv",
+}
+
+// cacheGoroutines belong to the cache of WithCachedClient, which lives as long as the environment.
+// It starts informers lazily, so they may show up during any testcase.
+var cacheGoroutines = []string{
+	"k8s.io/client-go/tools/cache.",
+	"sigs.k8s.io/controller-runtime/pkg/cache/internal.",
+}
+
+// WithGoroutineLeakCheck fails testcases which leave goroutines behind once cleaned up,
+// and the test if goroutines are left once the environment stopped.
+// Goroutines with any of ignore in their stack, e.g. "my.domain/pkg.(*Watcher).run",
+// are not reported, in addition to known background routines of envtest and client-go.
+func WithGoroutineLeakCheck(ignore ...string) Option {
+	return func(o *options) {
+		o.leakCheck = true
+		o.leakIgnore = append(o.leakIgnore, ignore...)
+	}
+}
+
+// goroutine is a single goroutine of a stack dump.
+type goroutine struct {
+	id    string
+	stack string
+}
+
+// goroutines returns all current goroutines, except the calling one.
+func goroutines() []goroutine {
+	self := goroutineID()
+	var gs []goroutine
+	for _, stack := range bytes.Split(allStacks(), []byte("\n\n")) {
+		// "goroutine 42 [chan receive]:"
+		fields := bytes.Fields(stack)
+		if len(fields) < 2 || string(fields[0]) != "goroutine" || string(fields[1]) == self {
+			continue
+		}
+		gs = append(gs, goroutine{id: string(fields[1]), stack: string(stack)})
+	}
+	return gs
+}
+
+// checkGoroutineLeaks fails t if goroutines started from now on are still running after its cleanup,
+// which runs after all cleanups registered later on.
+func checkGoroutineLeaks(t testing.TB, ignore []string) {
+	t.Helper()
+	before := map[string]bool{}
+	for _, g := range goroutines() {
+		before[g.id] = true
+	}
+	ignore = append(slices.Clone(ignoredGoroutines), ignore...)
+	t.Cleanup(func() {
+		var leaked []string
+		deadline := time.Now().Add(leakGrace)
+		for {
+			leaked = leaked[:0]
+			for _, g := range goroutines() {
+				if !before[g.id] && !slices.ContainsFunc(ignore, func(s string) bool { return strings.Contains(g.stack, s) }) {
+					leaked = append(leaked, g.stack)
+				}
+			}
+			if len(leaked) == 0 || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if len(leaked) > 0 {
+			t.Errorf("%d goroutines leaked, ignore known ones with WithGoroutineLeakCheck:\n\n%s",
+				len(leaked), strings.Join(leaked, "\n\n"))
+		}
+	})
+}
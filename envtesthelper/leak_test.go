@@ -0,0 +1,51 @@
+package envtesthelper
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_checkGoroutineLeaks(t *testing.T) {
+	leakGrace = 50 * time.Millisecond
+	defer func() { leakGrace = 5 * time.Second }()
+
+	tests := []struct {
+		name       string
+		ignore     []string
+		stop       bool
+		wantErrors int
+	}{
+		{
+			name:       "leaked",
+			wantErrors: 1,
+		},
+		{
+			name: "stopped in cleanup",
+			stop: true,
+		},
+		{
+			name:   "ignored",
+			ignore: []string{"Test_checkGoroutineLeaks"},
+		},
+	}
+	for _, tt := range tests {
+		release := make(chan struct{})
+		tb := &errorCapturingTB{}
+		t.Run(tt.name, func(t *testing.T) {
+			tb.TB = t
+			checkGoroutineLeaks(tb, tt.ignore)
+			go func() {
+				<-release
+			}()
+			if tt.stop {
+				t.Cleanup(func() { close(release) })
+			}
+		})
+		if !tt.stop {
+			close(release)
+		}
+		if len(tb.errors) != tt.wantErrors {
+			t.Errorf("%s: got errors %v, want %d", tt.name, tb.errors, tt.wantErrors)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package envtesthelper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// MultiClusterTestCase is a TestCase for reconcilers spanning several named clusters.
+type MultiClusterTestCase[R Reconciler] struct {
+	// Name of the testcase
+	Name string
+	// Cluster the Obj to reconcile lives in
+	Cluster string
+	// Obj to reconcile
+	Obj client.Object
+	// Previous state in cluster, by cluster name
+	State map[string][]client.Object
+	// Amount of reconciliation loops, defaults to 1
+	Loops int
+	// Desired result after all loops
+	Want ctrl.Result
+	// Desired error after all loops
+	WantErr error
+	// Time all reconciliations may take together, defaults to WithTimeout
+	Timeout time.Duration
+	// Sideeffects to assert after reconciliation, e.Clusters holds the client of every cluster.
+	// Objects created by controller should be cleaned up here.
+	WantSideEffects func(ctx context.Context, e *Env, r R)
+}
+
+// RunMultiClusterEnvTest bootstraps one testenv per named environment and executes all given testcases.
+// The reconciler receives a client per cluster as Env.Clusters, keyed by the names of envs, while the rest of
+// its Env belongs to the Cluster of the testcase.
+// newReconciler is called once per testcase.
+func RunMultiClusterEnvTest[R Reconciler](
+	t *testing.T,
+	addToScheme func(*runtime.Scheme) error,
+	envs map[string]*envtest.Environment,
+	newReconciler func(e *Env) R,
+	tests []MultiClusterTestCase[R],
+	opts ...Option,
+) {
+	t.Helper()
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	clients := startEnvs(t, o, addToScheme, envs)
+	recorder := &callRecorder{}
+	clusters := make(map[string]*envFactory, len(clients))
+	reconcilerClients := make(map[string]client.Client, len(clients))
+	for name, c := range clients {
+		clusters[name] = newEnvFactory(t, o, envs[name].Config, c, recorder, nil)
+		reconcilerClients[name] = clusters[name].client
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			cluster, ok := clusters[tt.Cluster]
+			if !ok {
+				t.Fatalf("unknown cluster %q", tt.Cluster)
+			}
+			e := cluster.newEnv(context.Background(), t)
+			e.Clusters = reconcilerClients
+			ctx := e.context(context.Background())
+			reconciler := newReconciler(e)
+
+			for _, name := range sortedKeys(tt.State) {
+				f, ok := clusters[name]
+				if !ok {
+					t.Fatalf("unknown cluster %q", name)
+				}
+				for _, obj := range tt.State[name] {
+					f.fixtures.create(ctx, t, obj)
+				}
+			}
+			cluster.fixtures.create(ctx, t, tt.Obj)
+
+			timeout := o.caseTimeout
+			if tt.Timeout > 0 {
+				timeout = tt.Timeout
+			}
+			reconcileCtx, cancel := caseContext(ctx, t, timeout)
+			defer cancel()
+			// a reconciler failing the testcase by hanging keeps recording otherwise
+			defer recorder.setEnabled(false)
+			req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(tt.Obj)}
+			var got ctrl.Result
+			var gotErr error
+			recorder.setEnabled(true)
+			for i := 0; i < max(1, tt.Loops); i++ {
+				got, gotErr = reconcile(reconcileCtx, t, reconciler, req, o.reconcileTimeout)
+			}
+			recorder.setEnabled(false)
+
+			if !assertResult(t, got, gotErr, tt.Want, tt.WantErr) {
+				return
+			}
+			if tt.WantSideEffects != nil {
+				tt.WantSideEffects(ctx, e, reconciler)
+			}
+		})
+	}
+	if o.rbacRolePath != "" {
+		reportRBAC(t, o, recorder.Calls())
+	}
+}
+
+// startEnvs starts all envs in order of their names. If one fails, the already started ones are stopped again.
+// All environments are stopped once the test and all its subtests completed.
+func startEnvs(
+	t *testing.T,
+	o *options,
+	addToScheme func(*runtime.Scheme) error,
+	envs map[string]*envtest.Environment,
+) map[string]client.Client {
+	t.Helper()
+	if err := addToScheme(scheme.Scheme); err != nil {
+		t.Fatalf("init scheme: %s", err)
+	}
+
+	var started []string
+	stop := func() error {
+		var errs []error
+		for i := len(started) - 1; i >= 0; i-- {
+			if err := envs[started[i]].Stop(); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", started[i], err))
+			}
+		}
+		return errors.Join(errs...)
+	}
+	clients := make(map[string]client.Client, len(envs))
+	for _, name := range sortedKeys(envs) {
+		if err := discoverAssets(envs[name], o.k8sVersion); err != nil {
+			t.Fatalf("init envtest %s: %s", name, errors.Join(err, stop()))
+		}
+		cfg, err := envs[name].Start()
+		if err != nil {
+			t.Fatalf("init envtest %s: %s", name, errors.Join(err, stop()))
+		}
+		started = append(started, name)
+		c, err := client.New(cfg, client.Options{})
+		if err != nil {
+			t.Fatalf("init client %s: %s", name, errors.Join(err, stop()))
+		}
+		clients[name] = c
+	}
+	t.Cleanup(func() {
+		if err := stop(); err != nil {
+			t.Fatal("stop testenv:", err)
+		}
+	})
+	return clients
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
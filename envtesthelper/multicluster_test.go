@@ -0,0 +1,78 @@
+package envtesthelper
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+func Test_RunMultiClusterEnvTest(t *testing.T) {
+	tests := []MultiClusterTestCase[*fleetReconciler]{
+		{
+			Name:    "copy to member",
+			Cluster: "hub",
+			Obj: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-cm",
+					Namespace: "default",
+				},
+				Data: map[string]string{"foo": "bar"},
+			},
+			WantSideEffects: func(ctx context.Context, e *Env, r *fleetReconciler) {
+				cm := &corev1.ConfigMap{}
+				err := e.Clusters["member"].Get(ctx, types.NamespacedName{Name: "test-cm", Namespace: "default"}, cm)
+				if err != nil {
+					e.T.Fatalf("get obj: %s", err)
+				}
+				if err := e.Clusters["member"].Delete(ctx, cm); err != nil {
+					e.T.Errorf("delete obj: %s", err)
+				}
+				if foo := cm.Data["foo"]; foo != "bar" {
+					e.T.Errorf("want %q, got %q", "bar", foo)
+				}
+			},
+		},
+	}
+	RunMultiClusterEnvTest(
+		t,
+		corev1.AddToScheme,
+		map[string]*envtest.Environment{
+			"hub":    {},
+			"member": {},
+		},
+		func(e *Env) *fleetReconciler {
+			return &fleetReconciler{Hub: e.Clusters["hub"], Member: e.Clusters["member"]}
+		},
+		tests,
+	)
+}
+
+// fleetReconciler copies configmaps from the hub to the member cluster.
+type fleetReconciler struct {
+	Hub    client.Client
+	Member client.Client
+}
+
+func (r *fleetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	src := &corev1.ConfigMap{}
+	if err := r.Hub.Get(ctx, req.NamespacedName, src); err != nil {
+		return ctrl.Result{}, fmt.Errorf("get obj: %w", err)
+	}
+	dst := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: src.Name, Namespace: src.Namespace}}
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Member, dst, func() error {
+		dst.Data = src.Data
+		return nil
+	})
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("update obj: %w", err)
+	}
+	return ctrl.Result{}, nil
+}
@@ -0,0 +1,240 @@
+package envtesthelper
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	"sigs.k8s.io/yaml"
+)
+
+// WithPersistentControlPlane connects to a control plane started by cmd/envtestd instead of starting a fresh one.
+// Also enabled by ENVTEST_PERSISTENT=true. If the control plane is not running or serves incompatible CRDs,
+// a fresh environment is started. Only applies to single cluster runs.
+//
+// Runs are isolated by their run namespace only, so fixtures must not set a namespace and must not be cluster scoped,
+// like Namespaces or ClusterRoles.
+// envtest has no namespace controller, so run namespaces stay terminating, including objects left in them,
+// until the control plane is restarted.
+func WithPersistentControlPlane() Option {
+	return func(o *options) {
+		o.persistent = true
+	}
+}
+
+// PersistentKubeconfig is where a persistent control plane publishes its kubeconfig,
+// $ENVTEST_PERSISTENT_KUBECONFIG or envtesthelper/kubeconfig in the user cache directory.
+func PersistentKubeconfig() string {
+	if path := os.Getenv("ENVTEST_PERSISTENT_KUBECONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "envtesthelper", "kubeconfig")
+}
+
+// ServePersistentControlPlane starts env, publishes its kubeconfig at PersistentKubeconfig
+// and blocks until ctx is done.
+func ServePersistentControlPlane(ctx context.Context, env *envtest.Environment, opts ...Option) (err error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if err := discoverAssets(env, o.k8sVersion); err != nil {
+		return err
+	}
+	if _, err := env.Start(); err != nil {
+		return fmt.Errorf("init envtest: %w", err)
+	}
+	defer func() {
+		if stopErr := env.Stop(); stopErr != nil {
+			err = errors.Join(err, fmt.Errorf("stop testenv: %w", stopErr))
+		}
+	}()
+	user, err := env.AddUser(envtest.User{Name: "envtesthelper", Groups: []string{"system:masters"}}, nil)
+	if err != nil {
+		return fmt.Errorf("add user: %w", err)
+	}
+	kubeconfig, err := user.KubeConfig()
+	if err != nil {
+		return fmt.Errorf("kubeconfig: %w", err)
+	}
+	path := PersistentKubeconfig()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create kubeconfig dir: %w", err)
+	}
+	if err := os.WriteFile(path, kubeconfig, 0o600); err != nil {
+		return fmt.Errorf("write kubeconfig: %w", err)
+	}
+	defer os.Remove(path)
+
+	<-ctx.Done()
+	return nil
+}
+
+// connectPersistent points env to the persistent control plane, if it is reachable and its CRDs are compatible.
+func connectPersistent(env *envtest.Environment) error {
+	kubeconfig, err := os.ReadFile(PersistentKubeconfig())
+	if err != nil {
+		return fmt.Errorf("read kubeconfig: %w", err)
+	}
+	cfg, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return fmt.Errorf("parse kubeconfig: %w", err)
+	}
+
+	probeCfg := *cfg
+	probeCfg.Timeout = 2 * time.Second
+	dc, err := discovery.NewDiscoveryClientForConfig(&probeCfg)
+	if err != nil {
+		return fmt.Errorf("init discovery: %w", err)
+	}
+	if _, err := dc.ServerVersion(); err != nil {
+		return fmt.Errorf("unreachable: %w", err)
+	}
+
+	crds, err := readCRDs(env)
+	if err != nil {
+		return err
+	}
+	s := runtime.NewScheme()
+	if err := apiextensionsv1.AddToScheme(s); err != nil {
+		return fmt.Errorf("init scheme: %w", err)
+	}
+	c, err := client.New(&probeCfg, client.Options{Scheme: s})
+	if err != nil {
+		return fmt.Errorf("init client: %w", err)
+	}
+	for _, crd := range crds {
+		existing := &apiextensionsv1.CustomResourceDefinition{}
+		err := c.Get(context.Background(), client.ObjectKeyFromObject(crd), existing)
+		switch {
+		case apierrors.IsNotFound(err):
+			// installed by envtest on start
+			continue
+		case err != nil:
+			return fmt.Errorf("get crd %s: %w", crd.Name, err)
+		case !compatibleCRDs(crd, existing):
+			return fmt.Errorf("crd %s differs from %s", crd.Name, PersistentKubeconfig())
+		}
+	}
+
+	env.Config = cfg
+	env.UseExistingCluster = ptr.To(true)
+	return nil
+}
+
+// compatibleCRDs compares the parts of two CRDs which are relevant to clients, ignoring server side defaults.
+func compatibleCRDs(want, got *apiextensionsv1.CustomResourceDefinition) bool {
+	if want.Spec.Group != got.Spec.Group || want.Spec.Names.Kind != got.Spec.Names.Kind || want.Spec.Scope != got.Spec.Scope {
+		return false
+	}
+	if len(want.Spec.Versions) != len(got.Spec.Versions) {
+		return false
+	}
+	for i, v := range want.Spec.Versions {
+		g := got.Spec.Versions[i]
+		if v.Name != g.Name || v.Served != g.Served || v.Storage != g.Storage ||
+			!equality.Semantic.DeepEqual(v.Schema, g.Schema) ||
+			!equality.Semantic.DeepEqual(v.Subresources, g.Subresources) {
+			return false
+		}
+	}
+	return true
+}
+
+// readCRDs reads the CRDs env would install.
+func readCRDs(env *envtest.Environment) ([]*apiextensionsv1.CustomResourceDefinition, error) {
+	crds := append(append([]*apiextensionsv1.CustomResourceDefinition(nil), env.CRDs...), env.CRDInstallOptions.CRDs...)
+	for _, path := range append(append([]string(nil), env.CRDDirectoryPaths...), env.CRDInstallOptions.Paths...) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("read crds: %w", err)
+		}
+		files := []string{path}
+		if info.IsDir() {
+			entries, err := os.ReadDir(path)
+			if err != nil {
+				return nil, fmt.Errorf("read crds: %w", err)
+			}
+			files = files[:0]
+			for _, e := range entries {
+				switch filepath.Ext(e.Name()) {
+				case ".json", ".yaml", ".yml":
+					files = append(files, filepath.Join(path, e.Name()))
+				}
+			}
+		}
+		for _, file := range files {
+			fileCRDs, err := readCRDFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("read crds %s: %w", file, err)
+			}
+			crds = append(crds, fileCRDs...)
+		}
+	}
+	return crds, nil
+}
+
+func readCRDFile(path string) ([]*apiextensionsv1.CustomResourceDefinition, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var crds []*apiextensionsv1.CustomResourceDefinition
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(f))
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return crds, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		crd := &apiextensionsv1.CustomResourceDefinition{}
+		if err := yaml.Unmarshal(doc, crd); err != nil {
+			return nil, err
+		}
+		if crd.Kind == "CustomResourceDefinition" {
+			crds = append(crds, crd)
+		}
+	}
+}
+
+// isolated fails if obj is not confined to the run namespace, which keeps runs on a shared control plane apart.
+// Namespaced objects are expected to be defaulted to the run namespace already.
+func (f *fixtureSet) isolated(obj client.Object) error {
+	key := client.ObjectKeyFromObject(obj)
+	if _, ok := obj.(*corev1.Namespace); ok {
+		return fmt.Errorf("namespace %s would stay terminating on the persistent control plane and collide with later runs, "+
+			"leave the namespace of fixtures empty to use the run namespace instead", key)
+	}
+	if obj.GetNamespace() == "" {
+		return fmt.Errorf("cluster scoped %T %s would collide with later runs on the persistent control plane, "+
+			"only namespaced fixtures are supported", obj, key)
+	}
+	if ns := obj.GetNamespace(); ns != f.namespace {
+		return fmt.Errorf("%T %s is not in the run namespace and would collide with later runs on the persistent control plane, "+
+			"leave its namespace empty to use the run namespace instead", obj, key)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package envtesthelper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+func Test_compatibleCRDs(t *testing.T) {
+	dir := t.TempDir()
+	crds := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: not-a-crd
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: guestbooks.example.com
+spec:
+  group: example.com
+  names:
+    kind: Guestbook
+    plural: guestbooks
+  scope: Namespaced
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+    subresources:
+      status: {}
+`
+	if err := os.WriteFile(filepath.Join(dir, "crds.yaml"), []byte(crds), 0o600); err != nil {
+		t.Fatalf("write crds: %s", err)
+	}
+	got, err := readCRDs(&envtest.Environment{CRDDirectoryPaths: []string{dir}})
+	if err != nil {
+		t.Fatalf("read crds: %s", err)
+	}
+	if len(got) != 1 || got[0].Name != "guestbooks.example.com" {
+		t.Fatalf("got: %v\nwant: guestbooks.example.com", got)
+	}
+
+	tests := []struct {
+		name string
+		mod  func(*apiextensionsv1.CustomResourceDefinition)
+		want bool
+	}{
+		{
+			name: "server side defaults",
+			mod: func(crd *apiextensionsv1.CustomResourceDefinition) {
+				crd.Spec.Conversion = &apiextensionsv1.CustomResourceConversion{Strategy: apiextensionsv1.NoneConverter}
+				crd.Spec.Names.ListKind = "GuestbookList"
+			},
+			want: true,
+		},
+		{
+			name: "schema changed",
+			mod: func(crd *apiextensionsv1.CustomResourceDefinition) {
+				crd.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties = map[string]apiextensionsv1.JSONSchemaProps{
+					"spec": {Type: "object"},
+				}
+			},
+		},
+		{
+			name: "subresource removed",
+			mod: func(crd *apiextensionsv1.CustomResourceDefinition) {
+				crd.Spec.Versions[0].Subresources = nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			existing := got[0].DeepCopy()
+			tt.mod(existing)
+			if compatible := compatibleCRDs(got[0], existing); compatible != tt.want {
+				t.Errorf("got: %t\nwant: %t", compatible, tt.want)
+			}
+		})
+	}
+}
+
+func Test_fixtureSet_isolated(t *testing.T) {
+	f := &fixtureSet{namespace: "envtest-abc", shared: true}
+	tests := []struct {
+		name    string
+		obj     client.Object
+		wantErr bool
+	}{
+		{
+			name: "run namespace",
+			obj:  &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "envtest-abc"}},
+		},
+		{
+			name:    "cluster scoped",
+			obj:     &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "role"}},
+			wantErr: true,
+		},
+		{
+			name:    "explicit namespace",
+			obj:     &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default"}},
+			wantErr: true,
+		},
+		{
+			name:    "namespace",
+			obj:     &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := f.isolated(tt.obj); (err != nil) != tt.wantErr {
+				t.Errorf("gotErr: %v\nwant: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package envtesthelper
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// RBACReport compares the permissions reconcilers used against the rules of a ClusterRole.
+// Verbs which are only issued by informers (list, watch) are never observed through the
+// reconciler's client and therefore show up as superfluous.
+// ResourceNames and NonResourceURLs are not taken into account.
+type RBACReport struct {
+	// Used rules, aggregated from all recorded calls
+	Used []rbacv1.PolicyRule
+	// Missing rules, used but not granted by the role
+	Missing []rbacv1.PolicyRule
+	// Superfluous rules, granted by the role but never used
+	Superfluous []rbacv1.PolicyRule
+}
+
+// permission is a single verb on a single (sub)resource, the smallest unit a PolicyRule grants.
+type permission struct {
+	group    string
+	resource string
+	verb     string
+}
+
+func (p permission) grantedBy(q permission) bool {
+	match := func(want, got string) bool { return got == rbacv1.ResourceAll || got == want }
+	return match(p.group, q.group) && match(p.resource, q.resource) && match(p.verb, q.verb)
+}
+
+// WithRBACReport logs an RBACReport of all calls the reconciler made across all testcases,
+// compared to the ClusterRole at rolePath, e.g. config/rbac/role.yaml.
+func WithRBACReport(rolePath string) Option {
+	return func(o *options) {
+		o.rbacRolePath = rolePath
+	}
+}
+
+// WithRBACMarkers additionally logs the kubebuilder rbac markers suggested by the RBACReport.
+func WithRBACMarkers() Option {
+	return func(o *options) {
+		o.rbacMarkers = true
+	}
+}
+
+func reportRBAC(t testing.TB, o *options, calls []Call) {
+	t.Helper()
+	role, err := LoadClusterRole(o.rbacRolePath)
+	if err != nil {
+		t.Errorf("rbac report: %s", err)
+		return
+	}
+	report := NewRBACReport(calls, role)
+	t.Logf("rbac report for %s:\n%s", o.rbacRolePath, report)
+	if o.rbacMarkers {
+		t.Logf("suggested rbac markers:\n%s", strings.Join(report.Markers(), "\n"))
+	}
+}
+
+// LoadClusterRole reads the ClusterRole from a yaml file, e.g. config/rbac/role.yaml.
+// Other documents in the file, e.g. a Role generated next to it, are ignored.
+// The file has to contain exactly one ClusterRole.
+func LoadClusterRole(path string) (*rbacv1.ClusterRole, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open role: %w", err)
+	}
+	defer f.Close()
+	var role *rbacv1.ClusterRole
+	decoder := yaml.NewYAMLOrJSONDecoder(f, 4096)
+	for {
+		doc := &rbacv1.ClusterRole{}
+		if err := decoder.Decode(doc); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("decode role: %w", err)
+		}
+		if doc.Kind != "ClusterRole" {
+			continue
+		}
+		if role != nil {
+			return nil, fmt.Errorf("decode role: %s contains more than one ClusterRole, %s and %s", path, role.Name, doc.Name)
+		}
+		role = doc
+	}
+	if role == nil {
+		return nil, fmt.Errorf("decode role: %s contains no ClusterRole", path)
+	}
+	return role, nil
+}
+
+// NewRBACReport aggregates the given calls and diffs them against the rules of role.
+func NewRBACReport(calls []Call, role *rbacv1.ClusterRole) *RBACReport {
+	used := map[permission]bool{}
+	for _, call := range calls {
+		resource := call.Resource.Resource
+		if call.Subresource != "" {
+			resource += "/" + call.Subresource
+		}
+		used[permission{group: call.Resource.Group, resource: resource, verb: call.Verb}] = true
+	}
+	granted := map[permission]bool{}
+	for _, rule := range role.Rules {
+		for _, p := range permissionsOf(rule) {
+			granted[p] = true
+		}
+	}
+
+	report := &RBACReport{Used: rulesOf(used)}
+	missing := map[permission]bool{}
+	for p := range used {
+		if !grantedByAny(p, granted) {
+			missing[p] = true
+		}
+	}
+	report.Missing = rulesOf(missing)
+	superfluous := map[permission]bool{}
+	for q := range granted {
+		if !grantsAny(q, used) {
+			superfluous[q] = true
+		}
+	}
+	report.Superfluous = rulesOf(superfluous)
+	return report
+}
+
+func grantedByAny(p permission, granted map[permission]bool) bool {
+	for q := range granted {
+		if p.grantedBy(q) {
+			return true
+		}
+	}
+	return false
+}
+
+func grantsAny(q permission, used map[permission]bool) bool {
+	for p := range used {
+		if p.grantedBy(q) {
+			return true
+		}
+	}
+	return false
+}
+
+func permissionsOf(rule rbacv1.PolicyRule) []permission {
+	var permissions []permission
+	for _, group := range rule.APIGroups {
+		for _, resource := range rule.Resources {
+			for _, verb := range rule.Verbs {
+				permissions = append(permissions, permission{group: group, resource: resource, verb: verb})
+			}
+		}
+	}
+	return permissions
+}
+
+// rulesOf folds permissions into rules, one per group and resource, sorted for stable output.
+func rulesOf(permissions map[permission]bool) []rbacv1.PolicyRule {
+	type groupResource struct{ group, resource string }
+	verbs := map[groupResource][]string{}
+	for p := range permissions {
+		gr := groupResource{group: p.group, resource: p.resource}
+		verbs[gr] = append(verbs[gr], p.verb)
+	}
+	rules := make([]rbacv1.PolicyRule, 0, len(verbs))
+	for gr, v := range verbs {
+		sort.Strings(v)
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{gr.group},
+			Resources: []string{gr.resource},
+			Verbs:     v,
+		})
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].APIGroups[0] != rules[j].APIGroups[0] {
+			return rules[i].APIGroups[0] < rules[j].APIGroups[0]
+		}
+		return rules[i].Resources[0] < rules[j].Resources[0]
+	})
+	return rules
+}
+
+// Markers returns the kubebuilder rbac markers granting exactly the used rules.
+func (r *RBACReport) Markers() []string {
+	markers := make([]string, 0, len(r.Used))
+	for _, rule := range r.Used {
+		group := rule.APIGroups[0]
+		if group == "" {
+			group = "core"
+		}
+		markers = append(markers, fmt.Sprintf(
+			"//+kubebuilder:rbac:groups=%s,resources=%s,verbs=%s",
+			group, rule.Resources[0], strings.Join(rule.Verbs, ";"),
+		))
+	}
+	return markers
+}
+
+func (r *RBACReport) String() string {
+	sb := &strings.Builder{}
+	writeRules := func(title string, rules []rbacv1.PolicyRule) {
+		fmt.Fprintf(sb, "%s:\n", title)
+		if len(rules) == 0 {
+			fmt.Fprintln(sb, "  none")
+		}
+		for _, rule := range rules {
+			fmt.Fprintf(sb, "  groups=%q resources=%s verbs=%s\n",
+				rule.APIGroups[0], rule.Resources[0], strings.Join(rule.Verbs, ";"))
+		}
+	}
+	writeRules("missing", r.Missing)
+	writeRules("superfluous", r.Superfluous)
+	return sb.String()
+}
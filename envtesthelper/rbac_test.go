@@ -0,0 +1,141 @@
+package envtesthelper
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_NewRBACReport(t *testing.T) {
+	ctx := context.Background()
+	recorder := &callRecorder{}
+	fc := fake.NewClientBuilder().Build()
+	c := newRecordingClient(fc, fc, recorder)
+
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default"}}
+	if err := c.Create(ctx, cm); err != nil {
+		t.Fatalf("create obj: %s", err)
+	}
+	recorder.setEnabled(true)
+	if err := c.Get(ctx, client.ObjectKeyFromObject(cm), cm); err != nil {
+		t.Fatalf("get obj: %s", err)
+	}
+	if err := c.Update(ctx, cm); err != nil {
+		t.Fatalf("update obj: %s", err)
+	}
+	_ = c.Status().Update(ctx, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default"}})
+	recorder.setEnabled(false)
+
+	path := filepath.Join(t.TempDir(), "role.yaml")
+	role := `---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: manager-role
+rules:
+- apiGroups:
+  - ""
+  resources:
+  - configmaps
+  verbs:
+  - get
+  - watch
+- apiGroups:
+  - apps
+  resources:
+  - deployments
+  verbs:
+  - "*"
+`
+	if err := os.WriteFile(path, []byte(role), 0o600); err != nil {
+		t.Fatalf("write role: %s", err)
+	}
+	gotRole, err := LoadClusterRole(path)
+	if err != nil {
+		t.Fatalf("load role: %s", err)
+	}
+	got := NewRBACReport(recorder.Calls(), gotRole)
+
+	want := &RBACReport{
+		Used: []rbacv1.PolicyRule{
+			{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get", "update"}},
+			{APIGroups: []string{""}, Resources: []string{"pods/status"}, Verbs: []string{"update"}},
+		},
+		Missing: []rbacv1.PolicyRule{
+			{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"update"}},
+			{APIGroups: []string{""}, Resources: []string{"pods/status"}, Verbs: []string{"update"}},
+		},
+		Superfluous: []rbacv1.PolicyRule{
+			{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"watch"}},
+			{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"*"}},
+		},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("got: %v\nwant: %v\ndiff: %s", got, want, diff)
+	}
+
+	wantMarkers := []string{
+		"//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;update",
+		"//+kubebuilder:rbac:groups=core,resources=pods/status,verbs=update",
+	}
+	if diff := cmp.Diff(got.Markers(), wantMarkers); diff != "" {
+		t.Errorf("got: %v\nwant: %v\ndiff: %s", got.Markers(), wantMarkers, diff)
+	}
+}
+
+func Test_LoadClusterRole(t *testing.T) {
+	clusterRole := func(name string) string {
+		return "apiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRole\nmetadata:\n  name: " + name + "\nrules: []\n"
+	}
+	role := "apiVersion: rbac.authorization.k8s.io/v1\nkind: Role\nmetadata:\n  name: leader-election\n  namespace: system\n"
+	tests := []struct {
+		name     string
+		yaml     string
+		wantName string
+		wantErr  bool
+	}{
+		{
+			name:     "single document",
+			yaml:     clusterRole("manager-role"),
+			wantName: "manager-role",
+		},
+		{
+			name:     "after a role",
+			yaml:     "---\n" + role + "---\n" + clusterRole("manager-role"),
+			wantName: "manager-role",
+		},
+		{
+			name:    "two cluster roles",
+			yaml:    clusterRole("manager-role") + "---\n" + clusterRole("other-role"),
+			wantErr: true,
+		},
+		{
+			name:    "no cluster role",
+			yaml:    role,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "role.yaml")
+			if err := os.WriteFile(path, []byte(tt.yaml), 0o600); err != nil {
+				t.Fatalf("write role: %s", err)
+			}
+			got, err := LoadClusterRole(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got err: %v, want err: %v", err, tt.wantErr)
+			}
+			if err == nil && got.Name != tt.wantName {
+				t.Errorf("got role %s, want %s", got.Name, tt.wantName)
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package envtesthelper
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Call is a single API request issued by a reconciler.
+type Call struct {
+	// Verb in RBAC terms, e.g. get, list, create, update, patch, delete, deletecollection
+	Verb string
+	// Resource the request targeted
+	Resource schema.GroupVersionResource
+	// Subresource the request targeted, e.g. status
+	Subresource string
+	// Namespace of the object, empty for cluster scoped objects and cluster wide lists
+	Namespace string
+	// Name of the object, empty for lists and failed creates with generateName
+	Name string
+	// Diff of the object caused by an update or patch, only captured on request
+	Diff string
+}
+
+// IsWrite reports whether the call modifies the cluster.
+func (c Call) IsWrite() bool {
+	switch c.Verb {
+	case "create", "update", "patch", "delete", "deletecollection":
+		return true
+	}
+	return false
+}
+
+// callRecorder collects calls while enabled, so only the reconciler's own requests end up in the record.
+type callRecorder struct {
+	mu      sync.Mutex
+	enabled bool
+	diffs   bool
+	calls   []Call
+	// distinct keeps only the first of equal calls, all of them are counted nevertheless
+	distinct bool
+	seen     map[Call]bool
+	count    int
+	writes   int
+}
+
+func (r *callRecorder) setEnabled(enabled bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enabled = enabled
+}
+
+// setDiffs enables capturing diffs of updates and patches, which costs an additional get per write.
+func (r *callRecorder) setDiffs(diffs bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.diffs = diffs
+}
+
+func (r *callRecorder) capturesDiffs() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.enabled && r.diffs
+}
+
+func (r *callRecorder) record(call Call) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.enabled {
+		return
+	}
+	r.count++
+	if call.IsWrite() {
+		r.writes++
+	}
+	if r.distinct {
+		if r.seen[call] {
+			return
+		}
+		if r.seen == nil {
+			r.seen = map[Call]bool{}
+		}
+		r.seen[call] = true
+	}
+	r.calls = append(r.calls, call)
+}
+
+// counts returns how many calls and writes were recorded, including repeated ones.
+func (r *callRecorder) counts() (calls, writes int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.count, r.writes
+}
+
+// Calls returns a copy of all recorded calls.
+func (r *callRecorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call(nil), r.calls...)
+}
+
+// recordingClient records every request before passing it to the wrapped client.
+type recordingClient struct {
+	client.Client
+	// harness reads the state before modifications for diffs, as Client may read from a stale cache
+	harness  client.Reader
+	recorder *callRecorder
+}
+
+func newRecordingClient(c client.Client, harness client.Reader, recorder *callRecorder) *recordingClient {
+	return &recordingClient{Client: c, harness: harness, recorder: recorder}
+}
+
+func (c *recordingClient) record(verb string, obj client.Object, subresource string) {
+	c.recorder.record(c.call(verb, obj, subresource))
+}
+
+func (c *recordingClient) call(verb string, obj client.Object, subresource string) Call {
+	return Call{
+		Verb:        verb,
+		Resource:    c.resourceFor(obj),
+		Subresource: subresource,
+		Namespace:   obj.GetNamespace(),
+		Name:        obj.GetName(),
+	}
+}
+
+// recordModification records an update or patch of obj done by modify, including its diff if requested.
+func (c *recordingClient) recordModification(ctx context.Context, verb string, obj client.Object, subresource string, modify func() error) error {
+	call := c.call(verb, obj, subresource)
+	var before client.Object
+	if c.recorder.capturesDiffs() {
+		before = obj.DeepCopyObject().(client.Object)
+		if err := c.harness.Get(ctx, client.ObjectKeyFromObject(obj), before); err != nil {
+			before = nil
+		}
+	}
+	err := modify()
+	if before != nil && err == nil {
+		call.Diff = objectDiff(before, obj)
+	}
+	c.recorder.record(call)
+	return err
+}
+
+// objectDiff compares two versions of an object, ignoring bookkeeping metadata.
+func objectDiff(before, after client.Object) string {
+	strip := func(obj client.Object) map[string]any {
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return nil
+		}
+		if metadata, ok := u["metadata"].(map[string]any); ok {
+			delete(metadata, "managedFields")
+			delete(metadata, "resourceVersion")
+		}
+		return u
+	}
+	return cmp.Diff(strip(before), strip(after))
+}
+
+func (c *recordingClient) recordList(list client.ObjectList, opts []client.ListOption) {
+	listOpts := &client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+	c.recorder.record(Call{
+		Verb:      "list",
+		Resource:  c.resourceFor(list),
+		Namespace: listOpts.Namespace,
+	})
+}
+
+// resourceFor resolves the resource of obj, falling back to a guessed plural if the mapping is unknown.
+func (c *recordingClient) resourceFor(obj runtime.Object) schema.GroupVersionResource {
+	gvk, err := c.GroupVersionKindFor(obj)
+	if err != nil {
+		return schema.GroupVersionResource{}
+	}
+	gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+	mapping, err := c.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		plural, _ := meta.UnsafeGuessKindToResource(gvk)
+		return plural
+	}
+	return mapping.Resource
+}
+
+func (c *recordingClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	c.recorder.record(Call{
+		Verb:      "get",
+		Resource:  c.resourceFor(obj),
+		Namespace: key.Namespace,
+		Name:      key.Name,
+	})
+	return c.Client.Get(ctx, key, obj, opts...)
+}
+
+func (c *recordingClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	c.recordList(list, opts)
+	return c.Client.List(ctx, list, opts...)
+}
+
+func (c *recordingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	// recorded afterwards, so objects created with generateName are recorded by the name the apiserver assigned
+	err := c.Client.Create(ctx, obj, opts...)
+	c.record("create", obj, "")
+	return err
+}
+
+func (c *recordingClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	c.record("delete", obj, "")
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func (c *recordingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	return c.recordModification(ctx, "update", obj, "", func() error {
+		return c.Client.Update(ctx, obj, opts...)
+	})
+}
+
+func (c *recordingClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return c.recordModification(ctx, "patch", obj, "", func() error {
+		return c.Client.Patch(ctx, obj, patch, opts...)
+	})
+}
+
+func (c *recordingClient) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) error {
+	c.record("deletecollection", obj, "")
+	return c.Client.DeleteAllOf(ctx, obj, opts...)
+}
+
+func (c *recordingClient) Status() client.SubResourceWriter {
+	return c.SubResource("status")
+}
+
+func (c *recordingClient) SubResource(subResource string) client.SubResourceClient {
+	return &recordingSubResourceClient{
+		SubResourceClient: c.Client.SubResource(subResource),
+		client:            c,
+		subResource:       subResource,
+	}
+}
+
+type recordingSubResourceClient struct {
+	client.SubResourceClient
+	client      *recordingClient
+	subResource string
+}
+
+func (c *recordingSubResourceClient) Get(ctx context.Context, obj client.Object, subResource client.Object, opts ...client.SubResourceGetOption) error {
+	c.client.record("get", obj, c.subResource)
+	return c.SubResourceClient.Get(ctx, obj, subResource, opts...)
+}
+
+func (c *recordingSubResourceClient) Create(ctx context.Context, obj client.Object, subResource client.Object, opts ...client.SubResourceCreateOption) error {
+	c.client.record("create", obj, c.subResource)
+	return c.SubResourceClient.Create(ctx, obj, subResource, opts...)
+}
+
+func (c *recordingSubResourceClient) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+	return c.client.recordModification(ctx, "update", obj, c.subResource, func() error {
+		return c.SubResourceClient.Update(ctx, obj, opts...)
+	})
+}
+
+func (c *recordingSubResourceClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	return c.client.recordModification(ctx, "patch", obj, c.subResource, func() error {
+		return c.SubResourceClient.Patch(ctx, obj, patch, opts...)
+	})
+}
@@ -0,0 +1,307 @@
+package envtesthelper
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// reportPaths returns where to write the JUnit and JSON report, empty if not requested.
+// Set by -envtest.junit-report and -envtest.json-report, or $ENVTEST_JUNIT_REPORT and $ENVTEST_JSON_REPORT.
+// As go test ./... runs a test binary per package, each one writes its own report next to the requested path,
+// see packageReportPath.
+func reportPaths() (junit, jsonPath string) {
+	junit, jsonPath = junitReportFlag, jsonReportFlag
+	if junit == "" {
+		junit = os.Getenv("ENVTEST_JUNIT_REPORT")
+	}
+	if jsonPath == "" {
+		jsonPath = os.Getenv("ENVTEST_JSON_REPORT")
+	}
+	pkg := testPackage()
+	return packageReportPath(junit, pkg), packageReportPath(jsonPath, pkg)
+}
+
+// packageReportPath inserts pkg before the extension of path, e.g. report.xml becomes report.controllers.xml.
+func packageReportPath(path, pkg string) string {
+	if path == "" || pkg == "" {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + pkg + ext
+}
+
+// testPackage names the package under test, by the directory go test runs its binary in,
+// relative to the module root, e.g. internal_controller for internal/controller.
+func testPackage() string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for dir := wd; ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			rel, err := filepath.Rel(dir, wd)
+			if err != nil || rel == "." {
+				return filepath.Base(wd)
+			}
+			return strings.ReplaceAll(filepath.ToSlash(rel), "/", "_")
+		}
+		if filepath.Dir(dir) == dir {
+			return filepath.Base(wd)
+		}
+	}
+}
+
+// suiteReport covers all testcases of one RunEnvTest or RunEnvTestGroups call.
+type suiteReport struct {
+	Name      string        `json:"name"`
+	Timestamp time.Time     `json:"timestamp"`
+	Duration  time.Duration `json:"duration"`
+	Cases     []*caseReport `json:"cases"`
+
+	mu sync.Mutex
+}
+
+// caseReport covers a single testcase.
+type caseReport struct {
+	Name       string        `json:"name"`
+	Labels     []string      `json:"labels,omitempty"`
+	Status     string        `json:"status"`
+	SkipReason string        `json:"skipReason,omitempty"`
+	Duration   time.Duration `json:"duration"`
+	Loops      int           `json:"loops"`
+	ErrDiff    string        `json:"errDiff,omitempty"`
+	ResultDiff string        `json:"resultDiff,omitempty"`
+	Logs       []string      `json:"logs,omitempty"`
+
+	mu   sync.Mutex
+	logs *caseLogs
+}
+
+const (
+	statusPassed  = "passed"
+	statusFailed  = "failed"
+	statusSkipped = "skipped"
+)
+
+// newSuiteReport returns nil if no report was requested.
+func newSuiteReport(t testing.TB) *suiteReport {
+	if junit, jsonPath := reportPaths(); junit == "" && jsonPath == "" {
+		return nil
+	}
+	return &suiteReport{Name: t.Name(), Timestamp: time.Now()}
+}
+
+// startCase adds the testcase running in t, which is completed once t finished.
+// Returns nil if s is nil.
+func (s *suiteReport) startCase(t testing.TB, labels []string) *caseReport {
+	if s == nil {
+		return nil
+	}
+	c := &caseReport{Name: strings.TrimPrefix(t.Name(), s.Name+"/"), Labels: labels}
+	s.mu.Lock()
+	s.Cases = append(s.Cases, c)
+	s.mu.Unlock()
+
+	start := time.Now()
+	t.Cleanup(func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.Duration = time.Since(start)
+		if c.logs != nil {
+			c.Logs = c.logs.lines()
+		}
+		switch {
+		case t.Skipped():
+			c.Status = statusSkipped
+		case t.Failed():
+			c.Status = statusFailed
+		default:
+			c.Status = statusPassed
+		}
+	})
+	return c
+}
+
+func (c *caseReport) skip(reason string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.SkipReason = reason
+}
+
+func (c *caseReport) result(loops int, got ctrl.Result, gotErr error, want ctrl.Result, wantErr error) {
+	if c == nil {
+		return
+	}
+	errDiff, resultDiff := resultDiffs(got, gotErr, want, wantErr)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Loops, c.ErrDiff, c.ResultDiff = loops, errDiff, resultDiff
+}
+
+// captureLogs adds everything logged to logs to the report of the testcase.
+func (c *caseReport) captureLogs(logs *caseLogs) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.logs = logs
+}
+
+// reports collects the suites of all runs in the test binary, so every write contains all of them.
+var reports struct {
+	mu     sync.Mutex
+	suites []*suiteReport
+}
+
+// write adds s to the reports and rewrites the requested report files.
+func (s *suiteReport) write(t testing.TB, start time.Time) {
+	if s == nil {
+		return
+	}
+	s.Duration = time.Since(start)
+	reports.mu.Lock()
+	defer reports.mu.Unlock()
+	reports.suites = append(reports.suites, s)
+
+	junit, jsonPath := reportPaths()
+	if junit != "" {
+		out, err := xml.MarshalIndent(junitReport(reports.suites), "", "  ")
+		if err != nil {
+			t.Errorf("encode junit report: %s", err)
+		} else if err := writeReport(junit, append([]byte(xml.Header), out...)); err != nil {
+			t.Errorf("write junit report: %s", err)
+		}
+	}
+	if jsonPath != "" {
+		out, err := json.MarshalIndent(reports.suites, "", "  ")
+		if err != nil {
+			t.Errorf("encode json report: %s", err)
+		} else if err := writeReport(jsonPath, out); err != nil {
+			t.Errorf("write json report: %s", err)
+		}
+	}
+}
+
+func writeReport(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     float64          `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      float64         `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name       string        `xml:"name,attr"`
+	Classname  string        `xml:"classname,attr"`
+	Time       float64       `xml:"time,attr"`
+	Properties *junitProps   `xml:"properties,omitempty"`
+	Failure    *junitFailure `xml:"failure,omitempty"`
+	Skipped    *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut  string        `xml:"system-out,omitempty"`
+}
+
+type junitProps struct {
+	Properties []junitProperty `xml:"property"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+func junitReport(suites []*suiteReport) junitTestSuites {
+	var out junitTestSuites
+	for _, s := range suites {
+		s.mu.Lock()
+		js := junitTestSuite{
+			Name:      s.Name,
+			Time:      s.Duration.Seconds(),
+			Timestamp: s.Timestamp.Format(time.RFC3339),
+		}
+		for _, c := range s.Cases {
+			js.Cases = append(js.Cases, c.junit(s.Name))
+			switch c.Status {
+			case statusFailed:
+				js.Failures++
+			case statusSkipped:
+				js.Skipped++
+			}
+		}
+		s.mu.Unlock()
+		js.Tests = len(js.Cases)
+		out.Tests += js.Tests
+		out.Failures += js.Failures
+		out.Skipped += js.Skipped
+		out.Time += js.Time
+		out.Suites = append(out.Suites, js)
+	}
+	return out
+}
+
+func (c *caseReport) junit(suite string) junitTestCase {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	jc := junitTestCase{
+		Name:      c.Name,
+		Classname: suite,
+		Time:      c.Duration.Seconds(),
+		SystemOut: strings.Join(c.Logs, "\n"),
+	}
+	props := []junitProperty{{Name: "loops", Value: fmt.Sprint(c.Loops)}}
+	if len(c.Labels) > 0 {
+		props = append(props, junitProperty{Name: "labels", Value: strings.Join(c.Labels, ",")})
+	}
+	jc.Properties = &junitProps{Properties: props}
+	switch c.Status {
+	case statusFailed:
+		jc.Failure = &junitFailure{Message: "testcase failed", Type: "failure"}
+		if diff := strings.TrimSpace(c.ErrDiff + "\n" + c.ResultDiff); diff != "" {
+			jc.Failure.Message = strings.SplitN(diff, "\n", 2)[0]
+			jc.Failure.Text = diff
+		}
+	case statusSkipped:
+		jc.Skipped = &junitSkipped{Message: c.SkipReason}
+	}
+	return jc
+}
@@ -0,0 +1,68 @@
+package envtesthelper
+
+import (
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func Test_junitReport(t *testing.T) {
+	s := &suiteReport{Name: t.Name()}
+	t.Run("passing", func(t *testing.T) {
+		c := s.startCase(t, []string{"smoke"})
+		c.result(2, ctrl.Result{}, nil, ctrl.Result{}, nil)
+		logs := &caseLogs{}
+		c.captureLogs(logs)
+		logTee{TB: t, logs: logs}.Log("reconciled")
+	})
+	t.Run("skipped", func(t *testing.T) {
+		c := s.startCase(t, nil)
+		c.skip("skipped by TestCase.Skip")
+		t.Skip("skipped by TestCase.Skip")
+	})
+	failed := &caseReport{Name: "failing", Status: statusFailed}
+	failed.result(1, ctrl.Result{}, errors.New("boom"), ctrl.Result{}, nil)
+	s.Cases = append(s.Cases, failed)
+
+	got := junitReport([]*suiteReport{s})
+	if got.Tests != 3 || got.Failures != 1 || got.Skipped != 1 {
+		t.Errorf("got tests=%d failures=%d skipped=%d, want 3, 1, 1", got.Tests, got.Failures, got.Skipped)
+	}
+	cases := got.Suites[0].Cases
+	if cases[0].Name != "passing" || cases[0].SystemOut != "reconciled" || cases[0].Failure != nil {
+		t.Errorf("got passing case: %+v", cases[0])
+	}
+	if cases[1].Skipped == nil || cases[1].Skipped.Message != "skipped by TestCase.Skip" {
+		t.Errorf("got skipped case: %+v", cases[1])
+	}
+	if cases[2].Failure == nil || !strings.Contains(cases[2].Failure.Text, "gotErr: boom") {
+		t.Errorf("got failing case: %+v", cases[2])
+	}
+
+	if _, err := xml.Marshal(got); err != nil {
+		t.Errorf("encode junit report: %s", err)
+	}
+}
+
+func Test_packageReportPath(t *testing.T) {
+	tests := []struct {
+		path, pkg, want string
+	}{
+		{path: "", pkg: "controller", want: ""},
+		{path: "/out/report.xml", pkg: "", want: "/out/report.xml"},
+		{path: "/out/report.xml", pkg: "internal_controller", want: "/out/report.internal_controller.xml"},
+		{path: "/out/report", pkg: "controller", want: "/out/report.controller"},
+	}
+	for _, tt := range tests {
+		if got := packageReportPath(tt.path, tt.pkg); got != tt.want {
+			t.Errorf("packageReportPath(%q, %q) = %q, want %q", tt.path, tt.pkg, got, tt.want)
+		}
+	}
+	// go test runs the binary in the package directory, which is the module root here
+	if got := testPackage(); got != "envtesthelper" {
+		t.Errorf("got package %q, want envtesthelper", got)
+	}
+}
@@ -0,0 +1,221 @@
+package envtesthelper
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// RequestSource lists the requests a reconciler should process, comparable to the watches of a controller.
+// opts have to be passed to every List, they confine it to the run namespace on a persistent control plane.
+type RequestSource func(ctx context.Context, c client.Client, opts ...client.ListOption) ([]ctrl.Request, error)
+
+// RequestsFor requests every object of the given list type, comparable to For() of a controller.
+func RequestsFor(list client.ObjectList) RequestSource {
+	return func(ctx context.Context, c client.Client, opts ...client.ListOption) ([]ctrl.Request, error) {
+		list := list.DeepCopyObject().(client.ObjectList)
+		if err := c.List(ctx, list, opts...); err != nil {
+			return nil, fmt.Errorf("list objs: %w", err)
+		}
+		var requests []ctrl.Request
+		err := meta.EachListItem(list, func(o runtime.Object) error {
+			obj, ok := o.(client.Object)
+			if !ok {
+				return fmt.Errorf("unexpected list item %T", o)
+			}
+			requests = append(requests, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(obj)})
+			return nil
+		})
+		return requests, err
+	}
+}
+
+// RequestsForOwner requests the controlling owner of type owner for every object of the given list type,
+// comparable to Owns() of a controller.
+func RequestsForOwner(list client.ObjectList, owner client.Object) RequestSource {
+	return func(ctx context.Context, c client.Client, opts ...client.ListOption) ([]ctrl.Request, error) {
+		ownerGVK, err := c.GroupVersionKindFor(owner)
+		if err != nil {
+			return nil, fmt.Errorf("owner kind: %w", err)
+		}
+		list := list.DeepCopyObject().(client.ObjectList)
+		if err := c.List(ctx, list, opts...); err != nil {
+			return nil, fmt.Errorf("list objs: %w", err)
+		}
+		seen := map[types.NamespacedName]bool{}
+		var requests []ctrl.Request
+		err = meta.EachListItem(list, func(o runtime.Object) error {
+			obj, ok := o.(client.Object)
+			if !ok {
+				return fmt.Errorf("unexpected list item %T", o)
+			}
+			ref := metav1.GetControllerOf(obj)
+			if ref == nil || ref.APIVersion != ownerGVK.GroupVersion().String() || ref.Kind != ownerGVK.Kind {
+				return nil
+			}
+			key := types.NamespacedName{Namespace: obj.GetNamespace(), Name: ref.Name}
+			if !seen[key] {
+				seen[key] = true
+				requests = append(requests, ctrl.Request{NamespacedName: key})
+			}
+			return nil
+		})
+		return requests, err
+	}
+}
+
+// ScenarioReconciler is one of several reconcilers cooperating within a Scenario.
+type ScenarioReconciler struct {
+	// Name of the reconciler, used in failure messages
+	Name string
+	// New creates the reconciler, once per scenario
+	New func(e *Env) Reconciler
+	// Requests to reconcile in every round, multiple sources are concatenated
+	Requests []RequestSource
+}
+
+// Scenario is a testcase for several reconcilers, which are run until the system is stable.
+type Scenario struct {
+	// Name of the scenario
+	Name string
+	// Previous state in cluster
+	State []client.Object
+	// Reconcilers taking part, run in the given order within each round
+	Reconcilers []ScenarioReconciler
+	// Maximum amount of rounds until the system has to be stable, defaults to 10
+	MaxRounds int
+	// Time all rounds may take together, defaults to WithTimeout
+	Timeout time.Duration
+	// Sideeffects to assert on the stable system, failures are reported with e.T.
+	// Objects created by controllers should be cleaned up here.
+	WantSideEffects func(ctx context.Context, e *Env)
+}
+
+// RunEnvScenarios bootstraps a testenv and executes all given scenarios.
+// Each round, every reconciler processes all of its requests. The system is stable after a round in which
+// no reconciler wrote to the cluster, returned an error or requested a requeue, immediate or after a delay.
+// Rounds do not wait for RequeueAfter, reconcilers which always requeue after a delay never get stable.
+func RunEnvScenarios(
+	t *testing.T,
+	addToScheme func(*runtime.Scheme) error,
+	env *envtest.Environment,
+	scenarios []Scenario,
+	opts ...Option,
+) {
+	t.Helper()
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	c, audit := startEnv(t, o, addToScheme, env)
+	recorder := &callRecorder{}
+	envs := newEnvFactory(t, o, env.Config, c, recorder, audit)
+
+	for _, sc := range scenarios {
+		t.Run(sc.Name, func(t *testing.T) {
+			e := envs.newEnv(context.Background(), t)
+			ctx := e.context(context.Background())
+			for _, obj := range sc.State {
+				envs.fixtures.create(ctx, t, obj)
+			}
+			var listOpts []client.ListOption
+			if o.shared {
+				// other runs share the control plane
+				listOpts = append(listOpts, client.InNamespace(e.RunNamespace))
+			}
+			reconcilers := make([]Reconciler, len(sc.Reconcilers))
+			for i, sr := range sc.Reconcilers {
+				reconcilers[i] = sr.New(e)
+			}
+
+			maxRounds := sc.MaxRounds
+			if maxRounds == 0 {
+				maxRounds = 10
+			}
+			timeout := o.caseTimeout
+			if sc.Timeout > 0 {
+				timeout = sc.Timeout
+			}
+			reconcileCtx, cancel := caseContext(ctx, t, timeout)
+			defer cancel()
+			// a reconciler failing the scenario by hanging keeps recording otherwise
+			defer recorder.setEnabled(false)
+			e.startAudit()
+			var unstable []string
+			for round := 1; round <= maxRounds; round++ {
+				unstable = nil
+				for i, sr := range sc.Reconcilers {
+					for _, source := range sr.Requests {
+						requests, err := source(reconcileCtx, c, listOpts...)
+						if err != nil {
+							t.Fatalf("%s: requests: %s", sr.Name, err)
+						}
+						for _, req := range requests {
+							if reason := reconcileOnce(reconcileCtx, t, reconcilers[i], req, recorder, o.reconcileTimeout); reason != "" {
+								unstable = append(unstable, fmt.Sprintf("%s %s: %s", sr.Name, req, reason))
+							}
+						}
+					}
+				}
+				if len(unstable) == 0 {
+					t.Logf("stable after %d rounds", round)
+					break
+				}
+				if err := reconcileCtx.Err(); err != nil {
+					t.Fatalf("not stable after %d rounds (%s):\n%v", round, err, unstable)
+				}
+			}
+			e.stopAudit(ctx)
+			if len(unstable) > 0 {
+				t.Errorf("not stable after %d rounds:\n%v", maxRounds, unstable)
+				return
+			}
+			if sc.WantSideEffects != nil {
+				sc.WantSideEffects(ctx, e)
+			}
+		})
+	}
+	if o.rbacRolePath != "" {
+		reportRBAC(t, o, recorder.Calls())
+	}
+}
+
+// reconcileOnce reconciles req and returns why the system is not stable yet, if so.
+// A single reconciliation is limited by timeout, if set.
+func reconcileOnce(
+	ctx context.Context,
+	t testing.TB,
+	r Reconciler,
+	req ctrl.Request,
+	recorder *callRecorder,
+	timeout time.Duration,
+) string {
+	t.Helper()
+	before := len(recorder.Calls())
+	recorder.setEnabled(true)
+	res, err := reconcile(ctx, t, r, req, timeout)
+	recorder.setEnabled(false)
+	switch {
+	case err != nil:
+		return fmt.Sprintf("error: %s", err)
+	case res.Requeue:
+		return "requeue"
+	case res.RequeueAfter > 0:
+		return fmt.Sprintf("requeue after %s", res.RequeueAfter)
+	}
+	for _, call := range recorder.Calls()[before:] {
+		if call.IsWrite() {
+			return fmt.Sprintf("%s %s %s/%s", call.Verb, call.Resource.Resource, call.Namespace, call.Name)
+		}
+	}
+	return ""
+}
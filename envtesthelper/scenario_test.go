@@ -0,0 +1,210 @@
+package envtesthelper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+func Test_RunEnvScenarios(t *testing.T) {
+	// created in the run namespace
+	parent := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "parent"}}
+	scenarios := []Scenario{
+		{
+			Name:  "parent waits for child",
+			State: []client.Object{parent},
+			Reconcilers: []ScenarioReconciler{
+				{
+					Name:     "parent",
+					New:      func(e *Env) Reconciler { return &parentReconciler{Client: e.Client} },
+					Requests: []RequestSource{RequestsFor(&corev1.ConfigMapList{})},
+				},
+				{
+					Name:     "child",
+					New:      func(e *Env) Reconciler { return &childReconciler{Client: e.Client} },
+					Requests: []RequestSource{RequestsFor(&corev1.SecretList{})},
+				},
+			},
+			WantSideEffects: func(ctx context.Context, e *Env) {
+				secret := &corev1.Secret{}
+				if err := e.Client.Get(ctx, client.ObjectKeyFromObject(parent), secret); err != nil {
+					e.T.Fatalf("get child: %s", err)
+				}
+				if err := e.Client.Delete(ctx, secret); err != nil {
+					e.T.Errorf("delete child: %s", err)
+				}
+				cm := &corev1.ConfigMap{}
+				if err := e.Client.Get(ctx, client.ObjectKeyFromObject(parent), cm); err != nil {
+					e.T.Fatalf("get parent: %s", err)
+				}
+				if ready := cm.Data["ready"]; ready != "true" {
+					e.T.Errorf("want %q, got %q", "true", ready)
+				}
+			},
+		},
+	}
+	RunEnvScenarios(
+		t,
+		corev1.AddToScheme,
+		&envtest.Environment{},
+		scenarios,
+	)
+}
+
+// parentReconciler creates a child secret for each configmap and marks the configmap ready once the child is.
+type parentReconciler struct {
+	Client client.Client
+}
+
+func (r *parentReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	cm := &corev1.ConfigMap{}
+	if err := r.Client.Get(ctx, req.NamespacedName, cm); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if cm.Name != "parent" {
+		return ctrl.Result{}, nil
+	}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: cm.Name, Namespace: cm.Namespace}}
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
+		return controllerutil.SetControllerReference(cm, secret, scheme.Scheme)
+	})
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("create child: %w", err)
+	}
+	if string(secret.Data["ready"]) != "true" || cm.Data["ready"] == "true" {
+		return ctrl.Result{}, nil
+	}
+	patch := client.MergeFrom(cm.DeepCopy())
+	cm.Data = map[string]string{"ready": "true"}
+	if err := r.Client.Patch(ctx, cm, patch); err != nil {
+		return ctrl.Result{}, fmt.Errorf("patch parent: %w", err)
+	}
+	return ctrl.Result{}, nil
+}
+
+// childReconciler marks every secret ready.
+type childReconciler struct {
+	Client client.Client
+}
+
+func (r *childReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	secret := &corev1.Secret{}
+	if err := r.Client.Get(ctx, req.NamespacedName, secret); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if string(secret.Data["ready"]) == "true" {
+		return ctrl.Result{}, nil
+	}
+	patch := client.MergeFrom(secret.DeepCopy())
+	secret.Data = map[string][]byte{"ready": []byte("true")}
+	if err := r.Client.Patch(ctx, secret, patch); err != nil {
+		return ctrl.Result{}, fmt.Errorf("patch child: %w", err)
+	}
+	return ctrl.Result{}, nil
+}
+
+// resultReconciler returns res and err, or waits for its context to be done if hang is set.
+type resultReconciler struct {
+	res  ctrl.Result
+	err  error
+	hang bool
+}
+
+func (r *resultReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	if r.hang {
+		<-ctx.Done()
+		return ctrl.Result{}, ctx.Err()
+	}
+	return r.res, r.err
+}
+
+func Test_reconcileOnce(t *testing.T) {
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "obj"}}
+	tests := []struct {
+		name       string
+		r          *resultReconciler
+		wantReason string
+		wantErrors int
+	}{
+		{
+			name: "stable",
+			r:    &resultReconciler{},
+		},
+		{
+			name:       "error",
+			r:          &resultReconciler{err: errors.New("boom")},
+			wantReason: "error: boom",
+		},
+		{
+			name:       "requeue",
+			r:          &resultReconciler{res: ctrl.Result{Requeue: true}},
+			wantReason: "requeue",
+		},
+		{
+			name:       "requeue after",
+			r:          &resultReconciler{res: ctrl.Result{RequeueAfter: time.Minute}},
+			wantReason: "requeue after 1m0s",
+		},
+		{
+			name:       "timeout",
+			r:          &resultReconciler{hang: true},
+			wantReason: "error: context deadline exceeded",
+			wantErrors: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := &errorCapturingTB{TB: t}
+			got := reconcileOnce(context.Background(), tb, tt.r, req, &callRecorder{}, 10*time.Millisecond)
+			if got != tt.wantReason {
+				t.Errorf("got reason %q, want %q", got, tt.wantReason)
+			}
+			if len(tb.errors) != tt.wantErrors {
+				t.Errorf("got errors %v, want %d", tb.errors, tt.wantErrors)
+			}
+		})
+	}
+}
+
+func Test_RequestSource_namespace(t *testing.T) {
+	owned := func(namespace string) *corev1.Secret {
+		owner := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "parent", UID: "uid"}}
+		s := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "child"}}
+		if err := controllerutil.SetControllerReference(owner, s, scheme.Scheme); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	c := fake.NewClientBuilder().WithObjects(owned("run"), owned("other-run")).Build()
+	want := []ctrl.Request{{NamespacedName: types.NamespacedName{Namespace: "run", Name: "child"}}}
+
+	got, err := RequestsFor(&corev1.SecretList{})(context.Background(), c, client.InNamespace("run"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("RequestsFor diff: %s", diff)
+	}
+
+	want[0].Name = "parent"
+	got, err = RequestsForOwner(&corev1.SecretList{}, &corev1.ConfigMap{})(context.Background(), c, client.InNamespace("run"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("RequestsForOwner diff: %s", diff)
+	}
+}
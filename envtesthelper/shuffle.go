@@ -0,0 +1,75 @@
+package envtesthelper
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// WithShuffle creates the fixtures of every testcase in an order permuted by seed, interleaving Obj among State.
+// Namespaces are always created first. Overrides -envtest.shuffle.
+func WithShuffle(seed int64) Option {
+	return func(o *options) {
+		o.shuffleSeed = &seed
+	}
+}
+
+// shuffleSeed returns the seed to permute fixtures with, false if they are created in order.
+func shuffleSeed(o *options) (int64, bool, error) {
+	if o.shuffleSeed != nil {
+		return *o.shuffleSeed, true, nil
+	}
+	switch shuffleFlag {
+	case "", "off":
+		return 0, false, nil
+	case "on":
+		return time.Now().UnixNano(), true, nil
+	}
+	seed, err := strconv.ParseInt(shuffleFlag, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid -envtest.shuffle %q: %w", shuffleFlag, err)
+	}
+	return seed, true, nil
+}
+
+// shuffleFixtures permutes objs depending on seed and the name of the testcase,
+// so a single testcase can be rerun with the same permutation.
+func shuffleFixtures(objs []client.Object, seed int64, name string) []client.Object {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	rng := rand.New(rand.NewSource(seed ^ int64(h.Sum64())))
+
+	var namespaces, others []client.Object
+	for _, obj := range objs {
+		if _, ok := fixtureObj(obj).(*corev1.Namespace); ok {
+			namespaces = append(namespaces, obj)
+		} else {
+			others = append(others, obj)
+		}
+	}
+	rng.Shuffle(len(others), func(i, j int) {
+		others[i], others[j] = others[j], others[i]
+	})
+	return append(namespaces, others...)
+}
+
+// logShuffleOnFailure tells how to reproduce the order fixtures were created in, if the test fails.
+func logShuffleOnFailure(t *testing.T, objs []client.Object, seed int64) {
+	t.Cleanup(func() {
+		if !t.Failed() {
+			return
+		}
+		order := make([]string, len(objs))
+		for i, obj := range objs {
+			order[i] = fmt.Sprintf("%T %s", fixtureObj(obj), client.ObjectKeyFromObject(obj))
+		}
+		t.Logf("fixtures created in shuffled order, rerun with -envtest.shuffle=%d:\n%s", seed, strings.Join(order, "\n"))
+	})
+}
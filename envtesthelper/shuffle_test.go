@@ -0,0 +1,45 @@
+package envtesthelper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func Test_shuffleFixtures(t *testing.T) {
+	objs := []client.Object{
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "a"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "b"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "c"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "d"}},
+	}
+	names := func(objs []client.Object) []string {
+		var names []string
+		for _, obj := range objs {
+			names = append(names, obj.GetName())
+		}
+		return names
+	}
+
+	got := names(shuffleFixtures(append([]client.Object(nil), objs...), 42, "case"))
+	if got[0] != "ns" {
+		t.Errorf("got: %v\nwant: namespace first", got)
+	}
+	again := names(shuffleFixtures(append([]client.Object(nil), objs...), 42, "case"))
+	if diff := cmp.Diff(got, again); diff != "" {
+		t.Errorf("same seed permuted differently\ndiff: %s", diff)
+	}
+
+	permutations := map[string]bool{}
+	for seed := int64(0); seed < 20; seed++ {
+		permutations[strings.Join(names(shuffleFixtures(append([]client.Object(nil), objs...), seed, "case")), ",")] = true
+	}
+	if len(permutations) < 2 {
+		t.Errorf("got %d permutations for 20 seeds, want several", len(permutations))
+	}
+}
@@ -0,0 +1,53 @@
+package envtesthelper
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// statusOf returns the status of obj, nil if it has none.
+func statusOf(obj client.Object) (map[string]any, error) {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, fmt.Errorf("convert %T: %w", obj, err)
+	}
+	status, _, err := unstructured.NestedMap(u, "status")
+	if err != nil {
+		return nil, fmt.Errorf("read status of %T: %w", obj, err)
+	}
+	return status, nil
+}
+
+// restoreStatus applies status through the status subresource, if creating obj dropped it.
+// obj is updated with the result.
+func (f *fixtureSet) restoreStatus(ctx context.Context, obj client.Object, status map[string]any) error {
+	if len(status) == 0 {
+		return nil
+	}
+	created, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return fmt.Errorf("convert %T: %w", obj, err)
+	}
+	if got, _, _ := unstructured.NestedMap(created, "status"); equality.Semantic.DeepEqual(got, status) {
+		return nil
+	}
+
+	gvk, err := f.c.GroupVersionKindFor(obj)
+	if err != nil {
+		return err
+	}
+	u := &unstructured.Unstructured{Object: created}
+	u.SetGroupVersionKind(gvk)
+	if err := unstructured.SetNestedMap(u.Object, status, "status"); err != nil {
+		return err
+	}
+	if err := f.c.Status().Update(ctx, u); err != nil {
+		return err
+	}
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, obj)
+}
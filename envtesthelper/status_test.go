@@ -0,0 +1,37 @@
+package envtesthelper
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_fixtureSet_create_status(t *testing.T) {
+	ctx := context.Background()
+	c := fake.NewClientBuilder().WithStatusSubresource(&corev1.Pod{}).Build()
+	f := newFixtureSet(t, c)
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default"},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+		},
+	}
+	f.create(ctx, t, pod)
+
+	got := &corev1.Pod{}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(pod), got); err != nil {
+		t.Fatalf("get obj: %s", err)
+	}
+	if got.Status.Phase != corev1.PodRunning || len(got.Status.Conditions) != 1 {
+		t.Errorf("got status %+v, want fixture status", got.Status)
+	}
+	if pod.ResourceVersion != got.ResourceVersion {
+		t.Errorf("got resourceVersion %s, want fixture updated to %s", pod.ResourceVersion, got.ResourceVersion)
+	}
+}
@@ -0,0 +1,141 @@
+package envtesthelper
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// timeline snapshots the objects relevant to a testcase after every reconcile loop,
+// so a failure can be traced back to the loop causing it.
+// Relevant are the fixtures and every object the reconciler wrote to.
+type timeline struct {
+	c         client.Client
+	refs      []objectRef
+	tracked   map[objectRef]bool
+	snapshots []map[objectRef]*unstructured.Unstructured
+}
+
+type objectRef struct {
+	gvk schema.GroupVersionKind
+	key client.ObjectKey
+}
+
+func (r objectRef) String() string {
+	if r.key.Namespace == "" {
+		return r.gvk.Kind + " " + r.key.Name
+	}
+	return r.gvk.Kind + " " + r.key.String()
+}
+
+func newTimeline(c client.Client) *timeline {
+	return &timeline{c: c, tracked: map[objectRef]bool{}}
+}
+
+func (tl *timeline) add(ref objectRef) {
+	if ref.key.Name == "" || tl.tracked[ref] {
+		return
+	}
+	tl.tracked[ref] = true
+	tl.refs = append(tl.refs, ref)
+}
+
+// track adds objs to the snapshots.
+func (tl *timeline) track(objs ...client.Object) {
+	for _, obj := range objs {
+		obj = fixtureObj(obj)
+		gvk, err := tl.c.GroupVersionKindFor(obj)
+		if err != nil {
+			continue
+		}
+		tl.add(objectRef{gvk: gvk, key: client.ObjectKeyFromObject(obj)})
+	}
+}
+
+// trackWrites adds the objects written by calls to the snapshots.
+func (tl *timeline) trackWrites(calls []Call) {
+	for _, call := range calls {
+		if !call.IsWrite() {
+			continue
+		}
+		gvk, err := tl.c.RESTMapper().KindFor(call.Resource)
+		if err != nil {
+			continue
+		}
+		tl.add(objectRef{gvk: gvk, key: client.ObjectKey{Namespace: call.Namespace, Name: call.Name}})
+	}
+}
+
+// snapshot records the current state of all tracked objects, absent ones are left out.
+// Objects failing to be read are assumed unchanged.
+func (tl *timeline) snapshot(ctx context.Context) {
+	snapshot := make(map[objectRef]*unstructured.Unstructured, len(tl.refs))
+	for _, ref := range tl.refs {
+		u := &unstructured.Unstructured{}
+		u.SetGroupVersionKind(ref.gvk)
+		err := tl.c.Get(ctx, ref.key, u)
+		switch {
+		case apierrors.IsNotFound(err):
+			continue
+		case err != nil:
+			if len(tl.snapshots) > 0 {
+				snapshot[ref] = tl.snapshots[len(tl.snapshots)-1][ref]
+			}
+			continue
+		}
+		snapshot[ref] = u
+	}
+	tl.snapshots = append(tl.snapshots, snapshot)
+}
+
+// String renders the changes of every loop, compared to the snapshot before it.
+func (tl *timeline) String() string {
+	sb := &strings.Builder{}
+	for i := 1; i < len(tl.snapshots); i++ {
+		before, after := tl.snapshots[i-1], tl.snapshots[i]
+		fmt.Fprintf(sb, "loop %d:\n", i)
+		changed := false
+		for _, ref := range tl.refs {
+			b, a := before[ref], after[ref]
+			switch {
+			case b == nil && a != nil:
+				fmt.Fprintf(sb, "  %s created\n", ref)
+			case b != nil && a == nil:
+				fmt.Fprintf(sb, "  %s deleted\n", ref)
+			case b != nil && a != nil:
+				diff := objectDiff(b, a)
+				if diff == "" {
+					continue
+				}
+				fmt.Fprintf(sb, "  %s changed:\n    %s\n", ref, strings.ReplaceAll(strings.TrimSpace(diff), "\n", "\n    "))
+			default:
+				continue
+			}
+			changed = true
+		}
+		if !changed {
+			sb.WriteString("  no changes\n")
+		}
+	}
+	return sb.String()
+}
+
+// logTimelineOnFailure prints tl if the test fails, and writes it as artifact.
+func logTimelineOnFailure(t testing.TB, tl *timeline) {
+	t.Cleanup(func() {
+		if !t.Failed() {
+			return
+		}
+		out := tl.String()
+		t.Logf("state per reconcile loop:\n%s", out)
+		if _, err := writeArtifact(t, "timeline.txt", []byte(out)); err != nil {
+			t.Log(err)
+		}
+	})
+}
@@ -0,0 +1,86 @@
+package envtesthelper
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta/testrestmapper"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_timeline(t *testing.T) {
+	ctx := context.Background()
+	c := fake.NewClientBuilder().WithRESTMapper(testrestmapper.TestOnlyStaticRESTMapper(scheme.Scheme)).Build()
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default"}}
+	if err := c.Create(ctx, cm); err != nil {
+		t.Fatalf("create obj: %s", err)
+	}
+	tl := newTimeline(c)
+	tl.track(cm)
+	tl.snapshot(ctx)
+
+	// loop 1 changes the fixture
+	cm.Data = map[string]string{"foo": "bar"}
+	if err := c.Update(ctx, cm); err != nil {
+		t.Fatalf("update obj: %s", err)
+	}
+	tl.snapshot(ctx)
+
+	// loop 2 creates a secret
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "default"}}
+	if err := c.Create(ctx, secret); err != nil {
+		t.Fatalf("create obj: %s", err)
+	}
+	tl.trackWrites([]Call{{
+		Verb:      "create",
+		Resource:  schema.GroupVersionResource{Version: "v1", Resource: "secrets"},
+		Namespace: "default",
+		Name:      "secret",
+	}})
+	tl.snapshot(ctx)
+
+	// loop 3 does nothing
+	tl.snapshot(ctx)
+
+	got := tl.String()
+	for _, want := range []string{
+		"loop 1:\n  ConfigMap default/cm changed:",
+		`"foo": string("bar")`,
+		"loop 2:\n  Secret default/secret created\n",
+		"loop 3:\n  no changes\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got timeline:\n%s\nwant it to contain:\n%s", got, want)
+		}
+	}
+}
+
+func Test_timeline_generateName(t *testing.T) {
+	ctx := context.Background()
+	fc := fake.NewClientBuilder().WithRESTMapper(testrestmapper.TestOnlyStaticRESTMapper(scheme.Scheme)).Build()
+	recorder := &callRecorder{}
+	c := newRecordingClient(fc, fc, recorder)
+	tl := newTimeline(fc)
+	tl.snapshot(ctx)
+
+	// loop 1 creates a secret with a generated name
+	recorder.setEnabled(true)
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{GenerateName: "secret-", Namespace: "default"}}
+	if err := c.Create(ctx, secret); err != nil {
+		t.Fatalf("create obj: %s", err)
+	}
+	recorder.setEnabled(false)
+	tl.trackWrites(recorder.Calls())
+	tl.snapshot(ctx)
+
+	got := tl.String()
+	want := "loop 1:\n  Secret default/" + secret.Name + " created\n"
+	if secret.Name == "" || !strings.Contains(got, want) {
+		t.Errorf("got timeline:\n%s\nwant it to contain:\n%s", got, want)
+	}
+}
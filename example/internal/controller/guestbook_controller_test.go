@@ -18,7 +18,6 @@ package controller
 
 import (
 	"context"
-	"fmt"
 	"path/filepath"
 	"testing"
 
@@ -62,8 +61,8 @@ func Test_Reconcile(t *testing.T) {
 	}
 	envtesthelper.RunEnvTest(
 		t, guestbookv1.AddToScheme, env,
-		func(c client.Client) *GuestbookReconciler {
-			return &GuestbookReconciler{Client: c}
+		func(e *envtesthelper.Env) *GuestbookReconciler {
+			return &GuestbookReconciler{Client: e.Client, Scheme: e.Scheme}
 		},
 		tests,
 	)
@@ -94,15 +93,14 @@ func fixtureNamespace(name string, mods ...func(*corev1.Namespace)) *corev1.Name
 	return f
 }
 
-func assertStatusDone(namespacedName types.NamespacedName) func(context.Context, *GuestbookReconciler) error {
-	return func(ctx context.Context, r *GuestbookReconciler) error {
+func assertStatusDone(namespacedName types.NamespacedName) func(context.Context, *envtesthelper.Env, *GuestbookReconciler) {
+	return func(ctx context.Context, e *envtesthelper.Env, r *GuestbookReconciler) {
 		got := &guestbookv1.Guestbook{}
 		if err := r.Client.Get(ctx, namespacedName, got); err != nil {
-			return err
+			e.T.Fatal(err)
 		}
 		if !got.Status.Done {
-			return fmt.Errorf("status should be done, was %t", got.Status.Done)
+			e.T.Errorf("status should be done, was %t", got.Status.Done)
 		}
-		return nil
 	}
 }